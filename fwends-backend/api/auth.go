@@ -61,18 +61,9 @@ type authVerifyHandler struct {
 
 func (h *authVerifyHandler) Handle(i handler.Input) (int, error) {
 	// determine authentication status via redis
-	var authenticated bool
-	session, err := i.Request.Cookie(h.cfg.Auth.SessionCookie)
-	if err != nil { // cookie not found
-		authenticated = false
-	} else {
-		key := h.cfg.Auth.SessionsRedisPrefix + session.Value
-		exists, err := h.rdb.Exists(i.Request.Context(), key).Result()
-		if err != nil {
-			return http.StatusInternalServerError, err
-		} else {
-			authenticated = exists == 1
-		}
+	authenticated, err := hasSession(i.Request.Context(), h.cfg, h.rdb, i.Request)
+	if err != nil {
+		return http.StatusInternalServerError, err
 	}
 
 	// respond with a boolean value
@@ -112,14 +103,13 @@ type authenticateHandler struct {
 
 func (h *authenticateHandler) Handle(i handler.Input) (int, error) {
 	// decode request body
-	decoder := json.NewDecoder(i.Request.Body)
 	var reqbody struct {
 		Token   string `json:"token"`
 		Service string `json:"service"`
 	}
-	err := decoder.Decode(&reqbody)
+	status, err := decodeJSONBody(h.cfg, i.Request, &reqbody)
 	if err != nil {
-		return http.StatusBadRequest, fmt.Errorf("failed to decode request body: %v", err)
+		return status, err
 	}
 
 	// get verified email from token
@@ -177,6 +167,29 @@ func (h *authenticateHandler) Handle(i handler.Input) (int, error) {
 
 // HELPERS
 
+// whether a request is from an admin. every request is when authentication is
+// disabled, as there is then no way to sign in.
+func isAuthenticated(ctx context.Context, cfg *config.Config, rdb *redis.Client, r *http.Request) (bool, error) {
+	if !cfg.Auth.Enable {
+		return true, nil
+	}
+	return hasSession(ctx, cfg, rdb, r)
+}
+
+// whether a request has the cookie of a session that has not expired
+func hasSession(ctx context.Context, cfg *config.Config, rdb *redis.Client, r *http.Request) (bool, error) {
+	session, err := r.Cookie(cfg.Auth.SessionCookie)
+	if err != nil { // cookie not found
+		return false, nil
+	}
+	key := cfg.Auth.SessionsRedisPrefix + session.Value
+	exists, err := rdb.Exists(ctx, key).Result()
+	if err != nil {
+		return false, err
+	}
+	return exists == 1, nil
+}
+
 type authServices struct {
 	google *oauth2.Service
 }
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fwends-backend/config"
+	"fwends-backend/util"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"go.uber.org/zap"
+)
+
+/*
+Example commands:
+
+kubectl exec fwends-backend-0 -- fwends-backend backfill-blurhash
+*/
+
+// BackfillBlurHashes encodes placeholders for pack images that do not have one,
+// such as those uploaded before placeholders were generated. Images that cannot be
+// fetched or decoded are logged and skipped, so the backfill can be run again.
+func BackfillBlurHashes(ctx context.Context, cfg *config.Config, db *sql.DB, s3c *s3.Client, logger *zap.Logger) error {
+	h := &packResourceHandler{cfg, db, s3c}
+
+	// the smallest variant is much quicker to decode than the original
+	rows, err := db.QueryContext(ctx,
+		`
+		SELECT
+			pack_resources.resource_id,
+			COALESCE((
+				SELECT resource_variants.variant_resource_id
+				FROM resource_variants
+				WHERE resource_variants.resource_id = pack_resources.resource_id
+				ORDER BY resource_variants.width * resource_variants.height
+				LIMIT 1
+			), pack_resources.resource_id)
+		FROM pack_resources
+			INNER JOIN resources ON resources.resource_id = pack_resources.resource_id
+		WHERE pack_resources.resource_class = 'image' AND resources.blurhash IS NULL
+		`,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var sources [][2]string
+	for rows.Next() {
+		var resourceID, sourceID string
+		err := rows.Scan(&resourceID, &sourceID)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, [2]string{resourceID, sourceID})
+	}
+	rows.Close()
+
+	for _, source := range sources {
+		resourceID, sourceID := source[0], source[1]
+		logger := logger.With(zap.String("resource_id", resourceID))
+		image, contentType, err := h.getResource(ctx, sourceID, cfg.Limits.MaxImageSize)
+		if err != nil {
+			// the resource may have been pruned since it was queried
+			logger.With(zap.Error(err)).Warn("failed to get image for blurhash")
+			continue
+		}
+		err = h.saveImageBlurHash(ctx, logger, resourceID, contentType, image)
+		if err != nil {
+			return err
+		}
+	}
+	logger.With(zap.Int("count", len(sources))).Info("backfilled image blurhashes")
+	return nil
+}
+
+// reads a resource from s3, along with its content type
+func (h *packResourceHandler) getResource(ctx context.Context, resourceID string, sizeLimit int64) ([]byte, string, error) {
+	object, err := h.s3c.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &h.cfg.S3.MediaBucket,
+		Key:    &resourceID,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	defer object.Body.Close()
+	b, err := io.ReadAll(util.NewLimitedReader(object.Body, sizeLimit))
+	if err != nil {
+		return nil, "", err
+	}
+	var contentType string
+	if object.ContentType != nil {
+		contentType = *object.ContentType
+	}
+	return b, contentType, nil
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"fwends-backend/config"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// presigns urls for resources that expire after the configured ttl, or gives their
+// unsigned url under the media base url if the ttl is zero. urls are signed for
+// fixed windows of half the ttl, so that they stay the same and can be cached within
+// a window, which leaves them valid for between half and all of the ttl.
+type mediaURLSigner struct {
+	cfg *config.Config
+	s3p *s3.PresignClient
+}
+
+func (s *mediaURLSigner) resourceURL(ctx context.Context, resourceID int64) (string, error) {
+	ttl := s.cfg.Media.MediaURLTTL
+	if ttl == 0 {
+		return mediaURL(&s.cfg.S3, resourceID), nil
+	}
+	key := strconv.FormatInt(resourceID, 10)
+	presigned, err := s.s3p.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: &s.cfg.S3.MediaBucket,
+		Key:    &key,
+	}, s3.WithPresignExpires(ttl), func(o *s3.PresignOptions) {
+		o.Presigner = windowedPresigner{v4.NewSigner(func(o *v4.SignerOptions) {
+			o.DisableURIPathEscaping = true
+		}), ttl / 2}
+	})
+	if err != nil {
+		return "", err
+	}
+	return presigned.URL, nil
+}
+
+// fills in the urls of a pack's cover, resources and image variants
+func (s *mediaURLSigner) packURLs(ctx context.Context, pack *packDetails) error {
+	var err error
+	if pack.Cover != 0 {
+		pack.CoverURL, err = s.resourceURL(ctx, pack.Cover)
+		if err != nil {
+			return err
+		}
+	}
+	for i := range pack.Roles {
+		for j := range pack.Roles[i].Strings {
+			str := &pack.Roles[i].Strings[j]
+			for _, resource := range []struct {
+				id  int64
+				url *string
+			}{
+				{str.Audio, &str.AudioURL},
+				{str.Image, &str.ImageURL},
+				{str.Text, &str.TextURL},
+				{str.Video, &str.VideoURL},
+			} {
+				if resource.id == 0 {
+					continue
+				}
+				*resource.url, err = s.resourceURL(ctx, resource.id)
+				if err != nil {
+					return err
+				}
+			}
+			for k := range str.ImageVariants {
+				variant := &str.ImageVariants[k]
+				variant.URL, err = s.resourceURL(ctx, variant.ID)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// signs as of the start of the window the signing time falls in
+type windowedPresigner struct {
+	presigner s3.HTTPPresignerV4
+	window    time.Duration
+}
+
+func (p windowedPresigner) PresignHTTP(
+	ctx context.Context, credentials aws.Credentials, r *http.Request,
+	payloadHash string, service string, region string, signingTime time.Time,
+	optFns ...func(*v4.SignerOptions),
+) (string, http.Header, error) {
+	return p.presigner.PresignHTTP(ctx, credentials, r,
+		payloadHash, service, region, signingTime.Truncate(p.window), optFns...,
+	)
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"fwends-backend/config"
+	"fwends-backend/handler"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+/*
+Example curl commands:
+
+curl -X PATCH http://localhost:8080/api/packs/6882582496895041536/bird -d '{"label":"Birds","position":1}'
+curl -X PATCH http://localhost:8080/api/packs/6882582496895041536/bird/eagle -d '{"label":"Bald Eagle"}'
+*/
+
+// PATCH /api/packs/:pack_id/:role_id
+//
+// Sets the display label and sort position of a role.
+func UpdatePackRole(cfg *config.Config, db *sql.DB) handler.Handler {
+	return &updatePackRoleHandler{cfg, db}
+}
+
+type updatePackRoleHandler struct {
+	cfg *config.Config
+	db  *sql.DB
+}
+
+func (h *updatePackRoleHandler) Handle(i handler.Input) (int, error) {
+	packID := i.Params.ByName("pack_id")
+	roleID := i.Params.ByName("role_id")
+
+	// validation
+	if !packResourceIDRegex.MatchString(roleID) {
+		return http.StatusBadRequest, fmt.Errorf("failed to validate role id: %v", roleID)
+	}
+	reqbody, status, err := decodePackLabelPatch(h.cfg, i.Request)
+	if err != nil {
+		return status, err
+	}
+
+	// upsert role row, fields omitted from the request are left unchanged, edits
+	// to the published revision start a new draft revision, roles only exist while
+	// they have resources so nothing is upserted for those that do not
+	result, err := h.db.ExecContext(i.Request.Context(),
+		`
+		WITH role AS (
+			SELECT 1 FROM pack_resources WHERE pack_id = $1 AND role_id = $2 LIMIT 1
+		), revised AS (
+			UPDATE packs SET revision = revision + 1
+			WHERE pack_id = $1 AND revision = published_revision AND EXISTS (SELECT 1 FROM role)
+		)
+		INSERT INTO pack_roles (pack_id, role_id, label, position)
+		SELECT $1, $2, COALESCE($3, ''), COALESCE($4, 0) FROM role
+		ON CONFLICT (pack_id, role_id) DO UPDATE SET
+			label = COALESCE($3, pack_roles.label),
+			position = COALESCE($4, pack_roles.position)
+		`,
+		packID, roleID, reqbody.Label, reqbody.Position,
+	)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return http.StatusNotFound, nil
+	}
+
+	return http.StatusOK, nil
+}
+
+// PATCH /api/packs/:pack_id/:role_id/:string_id
+//
+// Sets the display label and sort position of a string.
+func UpdatePackString(cfg *config.Config, db *sql.DB) handler.Handler {
+	return &updatePackStringHandler{cfg, db}
+}
+
+type updatePackStringHandler struct {
+	cfg *config.Config
+	db  *sql.DB
+}
+
+func (h *updatePackStringHandler) Handle(i handler.Input) (int, error) {
+	packID := i.Params.ByName("pack_id")
+	roleID := i.Params.ByName("role_id")
+	stringID := i.Params.ByName("string_id")
+
+	// validation
+	if !packResourceIDRegex.MatchString(roleID) {
+		return http.StatusBadRequest, fmt.Errorf("failed to validate role id: %v", roleID)
+	}
+	if !packResourceIDRegex.MatchString(stringID) {
+		return http.StatusBadRequest, fmt.Errorf("failed to validate string id: %v", stringID)
+	}
+	reqbody, status, err := decodePackLabelPatch(h.cfg, i.Request)
+	if err != nil {
+		return status, err
+	}
+
+	// upsert string row, fields omitted from the request are left unchanged, edits
+	// to the published revision start a new draft revision, strings only exist while
+	// they have resources so nothing is upserted for those that do not
+	result, err := h.db.ExecContext(i.Request.Context(),
+		`
+		WITH string AS (
+			SELECT 1 FROM pack_resources
+			WHERE pack_id = $1 AND role_id = $2 AND string_id = $3 LIMIT 1
+		), revised AS (
+			UPDATE packs SET revision = revision + 1
+			WHERE pack_id = $1 AND revision = published_revision AND EXISTS (SELECT 1 FROM string)
+		)
+		INSERT INTO pack_strings (pack_id, role_id, string_id, label, position)
+		SELECT $1, $2, $3, COALESCE($4, ''), COALESCE($5, 0) FROM string
+		ON CONFLICT (pack_id, role_id, string_id) DO UPDATE SET
+			label = COALESCE($4, pack_strings.label),
+			position = COALESCE($5, pack_strings.position)
+		`,
+		packID, roleID, stringID, reqbody.Label, reqbody.Position,
+	)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return http.StatusNotFound, nil
+	}
+
+	return http.StatusOK, nil
+}
+
+// HELPERS
+
+// a partial update to the display properties of a role or string
+type packLabelPatch struct {
+	Label    *string `json:"label"`
+	Position *int32  `json:"position"`
+}
+
+const maxPackLabelLength = 255
+
+func decodePackLabelPatch(cfg *config.Config, r *http.Request) (packLabelPatch, int, error) {
+	var patch packLabelPatch
+	status, err := decodeJSONBody(cfg, r, &patch)
+	if err != nil {
+		return patch, status, err
+	}
+	if patch.Label != nil {
+		label, err := normalizePackLabel(*patch.Label)
+		if err != nil {
+			return patch, http.StatusBadRequest, err
+		}
+		patch.Label = &label
+	}
+	return patch, http.StatusOK, nil
+}
+
+// trims a label and converts it to NFC, so that visually identical labels compare equal
+func normalizePackLabel(label string) (string, error) {
+	label = norm.NFC.String(strings.TrimSpace(label))
+	if utf8.RuneCountInString(label) > maxPackLabelLength {
+		return "", fmt.Errorf("label exceeds %d characters", maxPackLabelLength)
+	}
+	return label, nil
+}
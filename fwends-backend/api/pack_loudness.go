@@ -0,0 +1,182 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fwends-backend/config"
+	"fwends-backend/handler"
+	"math"
+	"net/http"
+	"sort"
+)
+
+/*
+Example curl commands:
+
+curl -X GET http://localhost:8080/api/packs/6882582496895041536/loudness
+*/
+
+// gain is held back so that peaks stay this far below full scale
+const audioPeakCeiling = -1.0 // dBFS
+
+// clips further than this from the pack's median loudness are flagged
+const loudnessOutlierThreshold = 6.0 // LU
+
+// peaks at least this loud are likely to have been clipped when recorded
+const clippedPeak = -0.1 // dBFS
+
+// GET /api/packs/:pack_id/loudness
+//
+// Reports the loudness of a pack's audio, flagging clips that stand out from the rest.
+func GetPackLoudness(cfg *config.Config, db *sql.DB) handler.Handler {
+	return &getPackLoudnessHandler{cfg, db}
+}
+
+type getPackLoudnessHandler struct {
+	cfg *config.Config
+	db  *sql.DB
+}
+
+type loudnessReportClip struct {
+	Role      string   `json:"role"`
+	String    string   `json:"string"`
+	Audio     int64    `json:"audio,string"`
+	Loudness  *float64 `json:"loudness"`  // LUFS
+	Peak      *float64 `json:"peak"`      // dBFS
+	Gain      *float64 `json:"gain"`      // dB
+	Deviation *float64 `json:"deviation"` // LU from the median
+	Flags     []string `json:"flags"`
+}
+
+func (h *getPackLoudnessHandler) Handle(i handler.Input) (int, error) {
+	packID := i.Params.ByName("pack_id")
+
+	// start a new transaction to ensure consistent state
+	tx, err := h.db.BeginTx(i.Request.Context(), &sql.TxOptions{
+		Isolation: sql.LevelRepeatableRead,
+		ReadOnly:  true,
+	})
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer tx.Rollback()
+
+	// check whether pack exists
+	rows, err := tx.QueryContext(i.Request.Context(), "SELECT 1 FROM packs WHERE pack_id = $1", packID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	packExists := rows.Next()
+	rows.Close()
+	if !packExists {
+		return http.StatusNotFound, nil
+	}
+
+	// query postgres for the pack's audio, in display order
+	rows, err = tx.QueryContext(i.Request.Context(),
+		`
+		SELECT
+			pack_resources.role_id,
+			pack_resources.string_id,
+			pack_resources.resource_id,
+			resources.loudness_lufs,
+			resources.peak_dbfs
+		FROM pack_resources
+			INNER JOIN resources ON resources.resource_id = pack_resources.resource_id
+			LEFT OUTER JOIN pack_roles ON
+				pack_roles.pack_id = pack_resources.pack_id AND
+				pack_roles.role_id = pack_resources.role_id
+			LEFT OUTER JOIN pack_strings ON
+				pack_strings.pack_id = pack_resources.pack_id AND
+				pack_strings.role_id = pack_resources.role_id AND
+				pack_strings.string_id = pack_resources.string_id
+		WHERE pack_resources.pack_id = $1 AND pack_resources.resource_class = 'audio'
+		ORDER BY
+			COALESCE(pack_roles.position, 0),
+			pack_resources.role_id,
+			COALESCE(pack_strings.position, 0),
+			pack_resources.string_id
+		`,
+		packID,
+	)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer rows.Close()
+	clips := make([]loudnessReportClip, 0)
+	measured := make([]float64, 0)
+	for rows.Next() {
+		var clip loudnessReportClip
+		var loudness sql.NullFloat64
+		var peak sql.NullFloat64
+		err := rows.Scan(&clip.Role, &clip.String, &clip.Audio, &loudness, &peak)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		clip.Flags = make([]string, 0)
+		if loudness.Valid && peak.Valid {
+			clip.Loudness = roundedFloat(loudness.Float64, 1)
+			clip.Peak = roundedFloat(peak.Float64, 1)
+			clip.Gain = roundedFloat(audioGain(h.cfg, loudness.Float64, peak.Float64), 1)
+			measured = append(measured, loudness.Float64)
+			if peak.Float64 >= clippedPeak {
+				clip.Flags = append(clip.Flags, "clipped")
+			}
+		} else {
+			// silent, or in a format that cannot be decoded
+			clip.Flags = append(clip.Flags, "unmeasured")
+		}
+		clips = append(clips, clip)
+	}
+	rows.Close()
+
+	var resbody struct {
+		TargetLoudness float64              `json:"targetLoudness"`
+		MedianLoudness *float64             `json:"medianLoudness"`
+		Clips          []loudnessReportClip `json:"clips"`
+	}
+	resbody.TargetLoudness = h.cfg.Media.AudioTargetLoudness
+	resbody.Clips = clips
+
+	// outliers are relative to the rest of the pack rather than the target, as
+	// clips far from their neighbours need the most gain to match them
+	if len(measured) > 0 {
+		sort.Float64s(measured)
+		median := measured[len(measured)/2]
+		if len(measured)%2 == 0 {
+			median = (measured[len(measured)/2-1] + median) / 2
+		}
+		resbody.MedianLoudness = roundedFloat(median, 1)
+		for i := range clips {
+			clip := &clips[i]
+			if clip.Loudness == nil {
+				continue
+			}
+			deviation := *clip.Loudness - median
+			clip.Deviation = roundedFloat(deviation, 1)
+			if deviation > loudnessOutlierThreshold {
+				clip.Flags = append(clip.Flags, "loud")
+			} else if deviation < -loudnessOutlierThreshold {
+				clip.Flags = append(clip.Flags, "quiet")
+			}
+		}
+	}
+
+	// respond to request
+	i.Response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(i.Response).Encode(resbody)
+
+	return http.StatusOK, nil
+}
+
+// gain in dB that brings audio to the target loudness, held back to keep its peak
+// below the ceiling, so quiet clips with loud peaks may fall short of the target
+func audioGain(cfg *config.Config, loudness float64, peak float64) float64 {
+	return math.Min(cfg.Media.AudioTargetLoudness-loudness, audioPeakCeiling-peak)
+}
+
+func roundedFloat(f float64, decimals int) *float64 {
+	scale := math.Pow(10, float64(decimals))
+	rounded := math.Round(f*scale) / scale
+	return &rounded
+}
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"fwends-backend/config"
+	"fwends-backend/handler"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/go-redis/redis/v8"
+)
+
+/*
+Example curl commands:
+
+curl -X GET http://localhost:8080/api/packs/6882582496895041536/bird/eagle/audio
+curl -X GET http://localhost:8080/api/packs/6882582496895041536/bird/eagle/audio?v=6882582496895041537 -H 'Range: bytes=0-1023'
+curl -X GET http://localhost:8080/api/packs/6882582496895041536/bird/eagle/audio?revision=published
+*/
+
+// resources never change once uploaded, so pinned urls can be cached for a year
+const packMediaPinnedCacheControl = "max-age=31536000, immutable"
+
+// unpinned urls change when the resource is replaced, so are revalidated by etag
+const packMediaCacheControl = "no-cache"
+
+// single byte ranges, which is all that s3 supports
+var packMediaRangeRegex = regexp.MustCompile(`^bytes=(\d+-\d*|-\d+)$`)
+
+// GET /api/packs/:pack_id/:role_id/:string_id/:class
+//
+// Streams the image, audio, video or text resource of a pack string, with its
+// canonical content type. Single byte ranges are supported for seeking. The etag
+// is the resource id, which can be pinned with a v query parameter for the
+// response to be cached indefinitely. Pinned resources that have since been
+// replaced are not found. Unauthenticated users, and those asking for the published
+// revision, get the resources of the published revision of the pack only, which are
+// the only responses that shared caches may store.
+func GetPackResource(cfg *config.Config, db *sql.DB, rdb *redis.Client, s3c *s3.Client) handler.Handler {
+	return &getPackResourceHandler{cfg, db, rdb, s3c}
+}
+
+type getPackResourceHandler struct {
+	cfg *config.Config
+	db  *sql.DB
+	rdb *redis.Client
+	s3c *s3.Client
+}
+
+func (h *getPackResourceHandler) Handle(i handler.Input) (int, error) {
+	packID := i.Params.ByName("pack_id")
+	roleID := i.Params.ByName("role_id")
+	stringID := i.Params.ByName("string_id")
+	resourceClass := i.Params.ByName("class")
+
+	// validation
+	if _, err := strconv.ParseInt(packID, 10, 64); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("failed to validate pack id: %v", packID)
+	}
+	if !packResourceIDRegex.MatchString(roleID) {
+		return http.StatusBadRequest, fmt.Errorf("failed to validate role id: %v", roleID)
+	}
+	if !packResourceIDRegex.MatchString(stringID) {
+		return http.StatusBadRequest, fmt.Errorf("failed to validate string id: %v", stringID)
+	}
+	switch resourceClass {
+	case "image", "audio", "video", "text":
+	default:
+		return http.StatusBadRequest, fmt.Errorf("failed to validate resource class: %v", resourceClass)
+	}
+
+	authenticated, err := isAuthenticated(i.Request.Context(), h.cfg, h.rdb, i.Request)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	// resources uploaded before content types were recorded fall back to s3's
+	var resourceID string
+	var contentType, size sql.NullString
+	askedForPublished := i.Request.URL.Query().Get("revision") == "published"
+	published := !authenticated || askedForPublished
+	if published {
+		err = h.db.QueryRowContext(i.Request.Context(),
+			`
+			SELECT published.resource_id, resources.content_type, resources.size
+			FROM (
+				SELECT (str->>$4)::bigint AS resource_id
+				FROM packs
+					INNER JOIN published_packs ON published_packs.pack_id = packs.pack_id,
+					jsonb_array_elements(published_packs.pack->'roles') AS role,
+					jsonb_array_elements(role->'strings') AS str
+				WHERE
+					packs.pack_id = $1 AND
+					packs.status IN ('published', 'archived') AND
+					role->>'id' = $2 AND
+					str->>'id' = $3
+			) AS published
+				LEFT OUTER JOIN resources ON resources.resource_id = published.resource_id
+			WHERE published.resource_id IS NOT NULL
+			`,
+			packID, roleID, stringID, resourceClass,
+		).Scan(&resourceID, &contentType, &size)
+	} else {
+		err = h.db.QueryRowContext(i.Request.Context(),
+			`
+			SELECT pack_resources.resource_id, resources.content_type, resources.size
+			FROM pack_resources
+				LEFT OUTER JOIN resources ON resources.resource_id = pack_resources.resource_id
+			WHERE
+				pack_resources.pack_id = $1 AND
+				pack_resources.role_id = $2 AND
+				pack_resources.string_id = $3 AND
+				pack_resources.resource_class = $4
+			`,
+			packID, roleID, stringID, resourceClass,
+		).Scan(&resourceID, &contentType, &size)
+	}
+	if err == sql.ErrNoRows {
+		return http.StatusNotFound, nil
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	// caching headers are sent with not modified responses too
+	etag := `"` + resourceID + `"`
+	cacheControl := packMediaCacheControl
+	if pinned := i.Request.URL.Query().Get("v"); pinned == resourceID {
+		cacheControl = packMediaPinnedCacheControl
+	} else if pinned != "" {
+		return http.StatusNotFound, nil
+	}
+	// only the published revision can be stored by shared caches, and which revision
+	// is streamed depends on the session cookie unless it is asked for
+	if published {
+		cacheControl = "public, " + cacheControl
+	} else {
+		cacheControl = "private, " + cacheControl
+	}
+	if h.cfg.Auth.Enable && !askedForPublished {
+		i.Response.Header().Set("Vary", "Cookie")
+	}
+	i.Response.Header().Set("ETag", etag)
+	i.Response.Header().Set("Cache-Control", cacheControl)
+	i.Response.Header().Set("Accept-Ranges", "bytes")
+	if etagMatches(i.Request.Header.Get("If-None-Match"), etag) {
+		i.Response.WriteHeader(http.StatusNotModified)
+		return http.StatusNotModified, nil
+	}
+
+	// other ranges are ignored, as is a range for a resource other than this one
+	var byteRange *string
+	if rangeHeader := i.Request.Header.Get("Range"); packMediaRangeRegex.MatchString(rangeHeader) {
+		if ifRange := i.Request.Header.Get("If-Range"); ifRange == "" || ifRange == etag {
+			byteRange = &rangeHeader
+		}
+	}
+
+	object, err := h.s3c.GetObject(i.Request.Context(), &s3.GetObjectInput{
+		Bucket: &h.cfg.S3.MediaBucket,
+		Key:    &resourceID,
+		Range:  byteRange,
+	})
+	if s3ErrorStatus(err) == http.StatusRequestedRangeNotSatisfiable {
+		if size.Valid {
+			i.Response.Header().Set("Content-Range", "bytes */"+size.String)
+		}
+		return http.StatusRequestedRangeNotSatisfiable, nil
+	} else if s3ErrorStatus(err) == http.StatusNotFound {
+		// the resource was replaced and pruned since it was queried
+		return http.StatusNotFound, nil
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer object.Body.Close()
+
+	// stream the resource
+	if !contentType.Valid && object.ContentType != nil {
+		contentType = sql.NullString{String: *object.ContentType, Valid: true}
+	}
+	if contentType.Valid {
+		i.Response.Header().Set("Content-Type", contentType.String)
+	} else {
+		i.Response.Header().Set("Content-Type", "application/octet-stream")
+	}
+	i.Response.Header().Set("X-Content-Type-Options", "nosniff")
+	i.Response.Header().Set("Content-Length", strconv.FormatInt(object.ContentLength, 10))
+	status := http.StatusOK
+	if object.ContentRange != nil {
+		i.Response.Header().Set("Content-Range", *object.ContentRange)
+		status = http.StatusPartialContent
+	}
+	i.Response.WriteHeader(status)
+	_, err = io.Copy(i.Response, object.Body)
+	return status, err
+}
+
+// whether an If-None-Match header lists an etag, weak comparison is used as
+// recommended for conditional gets
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
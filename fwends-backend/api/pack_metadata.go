@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+)
+
+// the descriptive fields of a pack, as returned by the api
+type packMetadata struct {
+	Title           string   `json:"title"`
+	Description     string   `json:"description"`
+	Tags            []string `json:"tags"`
+	Language        string   `json:"language"`
+	AgeRating       string   `json:"ageRating"`
+	Cover           int64    `json:"cover,string,omitempty"`
+	RequiredClasses []string `json:"requiredClasses"` // every string must have these to publish
+}
+
+// a partial update to pack metadata, absent fields are left unchanged
+type packMetadataPatch struct {
+	Title           *string   `json:"title"`
+	Description     *string   `json:"description"`
+	Tags            *[]string `json:"tags"`
+	Language        *string   `json:"language"`
+	AgeRating       *string   `json:"ageRating"`
+	RequiredClasses *[]string `json:"requiredClasses"`
+	// covers are uploaded separately, but can be removed with an explicit null
+	Cover json.RawMessage `json:"cover"`
+}
+
+const (
+	maxPackTitleLength       = 255
+	maxPackDescriptionLength = 4096
+	maxPackTags              = 32
+	maxPackTagLength         = 63
+	maxPackLanguageLength    = 35
+)
+
+var packAgeRatings = []string{"everyone", "teen", "mature"}
+
+var packResourceClasses = []string{"image", "audio", "text", "video"}
+
+// validates the fields present in the patch and normalizes them in place
+func (p *packMetadataPatch) normalize() error {
+	if p.Title != nil {
+		if len(*p.Title) == 0 {
+			return errors.New("empty pack title is not allowed")
+		} else if utf8.RuneCountInString(*p.Title) > maxPackTitleLength {
+			return fmt.Errorf("pack title exceeds %d characters", maxPackTitleLength)
+		}
+	}
+	if p.Description != nil {
+		if utf8.RuneCountInString(*p.Description) > maxPackDescriptionLength {
+			return fmt.Errorf("pack description exceeds %d characters", maxPackDescriptionLength)
+		}
+	}
+	if p.Tags != nil {
+		tags, err := normalizePackTags(*p.Tags)
+		if err != nil {
+			return err
+		}
+		p.Tags = &tags
+	}
+	if p.Language != nil {
+		lang, err := normalizePackLanguage(*p.Language)
+		if err != nil {
+			return err
+		}
+		p.Language = &lang
+	}
+	if p.AgeRating != nil {
+		if !isPackAgeRating(*p.AgeRating) {
+			return fmt.Errorf("unrecognized pack age rating: %v", *p.AgeRating)
+		}
+	}
+	if p.RequiredClasses != nil {
+		classes, err := normalizePackResourceClasses(*p.RequiredClasses)
+		if err != nil {
+			return err
+		}
+		p.RequiredClasses = &classes
+	}
+	if len(p.Cover) > 0 && !p.clearCover() {
+		return errors.New("pack cover can only be set to null, upload a cover image instead")
+	}
+	return nil
+}
+
+// whether the patch explicitly removes the pack cover
+func (p *packMetadataPatch) clearCover() bool {
+	return string(p.Cover) == "null"
+}
+
+// lowercases, trims and deduplicates tags, preserving their order
+func normalizePackTags(tags []string) ([]string, error) {
+	if len(tags) > maxPackTags {
+		return nil, fmt.Errorf("pack cannot have more than %d tags", maxPackTags)
+	}
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag, err := normalizePackTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized, nil
+}
+
+func normalizePackTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if len(tag) == 0 {
+		return "", errors.New("empty pack tag is not allowed")
+	} else if utf8.RuneCountInString(tag) > maxPackTagLength {
+		return "", fmt.Errorf("pack tag exceeds %d characters: %v", maxPackTagLength, tag)
+	}
+	return tag, nil
+}
+
+// converts a language to its canonical BCP 47 form
+func normalizePackLanguage(lang string) (string, error) {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse pack language: %v", err)
+	}
+	canonical := tag.String()
+	if len(canonical) > maxPackLanguageLength {
+		return "", fmt.Errorf("pack language exceeds %d characters", maxPackLanguageLength)
+	}
+	return canonical, nil
+}
+
+// deduplicates resource classes and puts them in their canonical order
+func normalizePackResourceClasses(classes []string) ([]string, error) {
+	seen := make(map[string]bool)
+	for _, class := range classes {
+		if !isPackResourceClass(class) {
+			return nil, fmt.Errorf("unrecognized resource class: %v", class)
+		}
+		seen[class] = true
+	}
+	normalized := make([]string, 0, len(seen))
+	for _, class := range packResourceClasses {
+		if seen[class] {
+			normalized = append(normalized, class)
+		}
+	}
+	return normalized, nil
+}
+
+func isPackResourceClass(class string) bool {
+	for _, c := range packResourceClasses {
+		if class == c {
+			return true
+		}
+	}
+	return false
+}
+
+func isPackAgeRating(rating string) bool {
+	for _, r := range packAgeRatings {
+		if rating == r {
+			return true
+		}
+	}
+	return false
+}
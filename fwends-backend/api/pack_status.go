@@ -0,0 +1,266 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fwends-backend/config"
+	"fwends-backend/handler"
+	"net/http"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/lib/pq"
+)
+
+/*
+Example curl commands:
+
+curl -X POST http://localhost:8080/api/packs/6882582496895041536/publish
+curl -X POST http://localhost:8080/api/packs/6882582496895041536/archive
+curl -X GET http://localhost:8080/api/packs/6882582496895041536?revision=published
+*/
+
+var packStatuses = []string{"draft", "published", "archived"}
+
+// POST /api/packs/:pack_id/publish
+//
+// Publishes the current revision of a pack, which is what unauthenticated users see
+// of it until it is published again. Packs with blocking validation problems, such
+// as strings without the resource classes the pack requires, are not published and
+// the validation report is returned instead. Archived packs are published again, and
+// publishing a revision that is already published does nothing.
+func PublishPack(cfg *config.Config, db *sql.DB, s3c *s3.Client) handler.Handler {
+	return &publishPackHandler{packResourceHandler{cfg, db, s3c}}
+}
+
+type publishPackHandler struct {
+	packResourceHandler
+}
+
+func (h *publishPackHandler) Handle(i handler.Input) (int, error) {
+	packID := i.Params.ByName("pack_id")
+
+	for {
+		status, report, unpublished, err := h.transaction(i.Request.Context(), packID)
+		if isRetryableSerializationFailure(err) {
+			continue
+		} else if err == errPackNotFoundError {
+			return http.StatusNotFound, nil
+		} else if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		// the previously published revision no longer holds its resources
+		for _, resourceID := range unpublished {
+			go h.pruneResource(context.Background(), strconv.FormatInt(resourceID, 10))
+		}
+
+		i.Response.Header().Set("Content-Type", "application/json")
+		if !report.Valid {
+			i.Response.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(i.Response).Encode(report)
+			return http.StatusUnprocessableEntity, nil
+		}
+		json.NewEncoder(i.Response).Encode(status)
+		return http.StatusOK, nil
+	}
+}
+
+// publishes a pack unless it has blocking problems, returning the resources that
+// were held by the revision that was published before
+func (h *publishPackHandler) transaction(
+	ctx context.Context, packID string,
+) (packStatus, packValidationReport, []int64, error) {
+	report := packValidationReport{Valid: true}
+
+	// begin a new transcation
+	tx, err := h.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelSerializable,
+	})
+	if err != nil {
+		return packStatus{}, report, nil, err
+	}
+	defer tx.Rollback()
+
+	// lock the pack so that it cannot be edited while it is published
+	_, err = tx.ExecContext(ctx, "SELECT 1 FROM packs WHERE pack_id = $1 FOR UPDATE", packID)
+	if err != nil {
+		return packStatus{}, report, nil, err
+	}
+	details, status, err := queryPackDetails(ctx, h.cfg, tx, packID)
+	if err != nil {
+		return status, report, nil, err
+	}
+	if status.Status == "published" && status.Revision == status.PublishedRevision {
+		return status, report, nil, nil
+	}
+	report = validatePack(h.cfg, details)
+	if !report.Valid {
+		return status, report, nil, nil
+	}
+
+	// the published revision holds its own reference to each of its resources, so
+	// that they are kept when they are replaced or removed from the draft
+	resourceIDs := packDetailsResourceIDs(details)
+	result, err := tx.ExecContext(ctx,
+		"UPDATE resources SET ref_count = ref_count + 1 WHERE resource_id = ANY($1)",
+		pq.Array(resourceIDs),
+	)
+	if err != nil {
+		return status, report, nil, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected != int64(len(resourceIDs)) {
+		return status, report, nil, errors.New("inconsistent rows affected")
+	}
+
+	// replace the previously published revision
+	var unpublished []int64
+	err = tx.QueryRowContext(ctx,
+		"SELECT resource_ids FROM published_packs WHERE pack_id = $1", packID,
+	).Scan(pq.Array(&unpublished))
+	if err != nil && err != sql.ErrNoRows {
+		return status, report, nil, err
+	}
+	snapshot, err := json.Marshal(details)
+	if err != nil {
+		return status, report, nil, err
+	}
+	_, err = tx.ExecContext(ctx,
+		`
+		INSERT INTO published_packs (pack_id, revision, pack, resource_ids)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (pack_id) DO UPDATE SET
+			revision = $2,
+			pack = $3,
+			resource_ids = $4,
+			published_at = now()
+		`,
+		packID, status.Revision, string(snapshot), pq.Array(resourceIDs),
+	)
+	if err != nil {
+		return status, report, nil, err
+	}
+	_, err = tx.ExecContext(ctx,
+		"UPDATE packs SET status = 'published', published_revision = revision WHERE pack_id = $1",
+		packID,
+	)
+	if err != nil {
+		return status, report, nil, err
+	}
+
+	// commit transaction
+	err = tx.Commit()
+	if err != nil {
+		return status, report, nil, err
+	}
+
+	status.Status = "published"
+	status.PublishedRevision = status.Revision
+	return status, report, unpublished, nil
+}
+
+// POST /api/packs/:pack_id/archive
+//
+// Archives a published pack, so that it is no longer listed for unauthenticated
+// users. Its published revision can still be got by id, for games that use it.
+func ArchivePack(cfg *config.Config, db *sql.DB) handler.Handler {
+	return &archivePackHandler{cfg, db}
+}
+
+type archivePackHandler struct {
+	cfg *config.Config
+	db  *sql.DB
+}
+
+func (h *archivePackHandler) Handle(i handler.Input) (int, error) {
+	packID := i.Params.ByName("pack_id")
+
+	var status, previousStatus packStatus
+	err := h.db.QueryRowContext(i.Request.Context(),
+		`
+		WITH previous AS (
+			SELECT pack_id, status FROM packs WHERE pack_id = $1 FOR UPDATE
+		)
+		UPDATE packs SET
+			status = CASE WHEN previous.status = 'draft' THEN packs.status ELSE 'archived' END
+		FROM previous
+		WHERE packs.pack_id = previous.pack_id
+		RETURNING previous.status, packs.status, packs.revision, COALESCE(packs.published_revision, 0)
+		`,
+		packID,
+	).Scan(&previousStatus.Status, &status.Status, &status.Revision, &status.PublishedRevision)
+	if err == sql.ErrNoRows {
+		return http.StatusNotFound, nil
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	} else if previousStatus.Status == "draft" {
+		return http.StatusConflict, handler.NewPublicError(
+			errors.New("only published packs can be archived"),
+		)
+	}
+
+	i.Response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(i.Response).Encode(status)
+	return http.StatusOK, nil
+}
+
+// HELPERS
+
+// the distinct resources of a pack, image variants are held by their original
+func packDetailsResourceIDs(pack packDetails) []int64 {
+	seen := make(map[int64]bool)
+	ids := make([]int64, 0)
+	add := func(id int64) {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	add(pack.Cover)
+	for _, role := range pack.Roles {
+		for _, str := range role.Strings {
+			add(str.Image)
+			add(str.Audio)
+			add(str.Text)
+			add(str.Video)
+		}
+	}
+	return ids
+}
+
+// reads the published revision of a pack, packs that have not been published are
+// not found
+func readPublishedPack(ctx context.Context, db *sql.DB, packID string) (packDetails, packStatus, error) {
+	var details packDetails
+	var status packStatus
+	var snapshot []byte
+	err := db.QueryRowContext(ctx,
+		`
+		SELECT packs.status, published_packs.revision, published_packs.pack
+		FROM packs
+			INNER JOIN published_packs ON published_packs.pack_id = packs.pack_id
+		WHERE packs.pack_id = $1 AND packs.status IN ('published', 'archived')
+		`,
+		packID,
+	).Scan(&status.Status, &status.Revision, &snapshot)
+	if err == sql.ErrNoRows {
+		return details, status, errPackNotFoundError
+	} else if err != nil {
+		return details, status, err
+	}
+	status.PublishedRevision = status.Revision
+	err = json.Unmarshal(snapshot, &details)
+	return details, status, err
+}
+
+func isPackStatus(status string) bool {
+	for _, s := range packStatuses {
+		if status == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,288 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"fwends-backend/config"
+	"fwends-backend/handler"
+	"net/http"
+	"strconv"
+)
+
+/*
+Example curl commands:
+
+curl -X GET http://localhost:8080/api/packs/6882582496895041536/validate
+*/
+
+// GET /api/packs/:pack_id/validate
+//
+// Reports problems with the current revision of a pack that are worth fixing before
+// it is shared. Which rules block publishing, and their thresholds, are configured.
+func ValidatePack(cfg *config.Config, db *sql.DB) handler.Handler {
+	return &validatePackHandler{cfg, db}
+}
+
+type validatePackHandler struct {
+	cfg *config.Config
+	db  *sql.DB
+}
+
+func (h *validatePackHandler) Handle(i handler.Input) (int, error) {
+	packID := i.Params.ByName("pack_id")
+
+	// start a new transaction to ensure consistent state
+	tx, err := h.db.BeginTx(i.Request.Context(), &sql.TxOptions{
+		Isolation: sql.LevelRepeatableRead,
+		ReadOnly:  true,
+	})
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer tx.Rollback()
+
+	details, _, err := queryPackDetails(i.Request.Context(), h.cfg, tx, packID)
+	if err == errPackNotFoundError {
+		return http.StatusNotFound, nil
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	i.Response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(i.Response).Encode(validatePack(h.cfg, details))
+	return http.StatusOK, nil
+}
+
+// HELPERS
+
+const (
+	packRuleNoStrings         = "no_strings"
+	packRuleMissingResources  = "missing_resources"
+	packRuleFewStrings        = "few_strings"
+	packRuleOversizedMedia    = "oversized_media"
+	packRuleLegacyContentType = "legacy_content_type"
+	packRuleDuplicateMedia    = "duplicate_media"
+)
+
+type packValidationReport struct {
+	Valid    bool          `json:"valid"` // whether there are no blocking problems
+	Problems []packProblem `json:"problems"`
+}
+
+// something a rule found wrong with a pack, blocking problems prevent publishing
+type packProblem struct {
+	Rule     string   `json:"rule"`
+	Blocking bool     `json:"blocking"`
+	Role     string   `json:"role,omitempty"`
+	String   string   `json:"string,omitempty"`
+	Class    string   `json:"class,omitempty"`
+	Resource int64    `json:"resource,string,omitempty"`
+	Missing  []string `json:"missing,omitempty"` // resource classes
+	Strings  []string `json:"strings,omitempty"` // role/string pairs sharing the resource
+	Message  string   `json:"message"`
+}
+
+// checks a pack against every rule, marking the problems that block publishing
+func validatePack(cfg *config.Config, pack packDetails) packValidationReport {
+	var problems []packProblem
+	if len(pack.Roles) == 0 {
+		problems = append(problems, packProblem{
+			Rule:    packRuleNoStrings,
+			Message: "pack has no strings",
+		})
+	}
+
+	// strings without the resource classes the pack requires
+	for _, role := range pack.Roles {
+		for _, str := range role.Strings {
+			var missing []string
+			for _, class := range pack.RequiredClasses {
+				if packStringResource(str, class) == 0 {
+					missing = append(missing, class)
+				}
+			}
+			if len(missing) > 0 {
+				problems = append(problems, packProblem{
+					Rule:    packRuleMissingResources,
+					Role:    role.ID,
+					String:  str.ID,
+					Missing: missing,
+					Message: fmt.Sprintf("string %v/%v is missing required resources", role.ID, str.ID),
+				})
+			}
+		}
+	}
+
+	// roles with too few strings to go round
+	for _, role := range pack.Roles {
+		if len(role.Strings) < cfg.Validation.MinRoleStrings {
+			problems = append(problems, packProblem{
+				Rule:    packRuleFewStrings,
+				Role:    role.ID,
+				Message: fmt.Sprintf("role %v has fewer than %d strings", role.ID, cfg.Validation.MinRoleStrings),
+			})
+		}
+	}
+
+	// media that is slow to load, or may not play everywhere
+	for _, role := range pack.Roles {
+		for _, str := range role.Strings {
+			for _, class := range packResourceClasses {
+				id := packStringResource(str, class)
+				if id == 0 {
+					continue
+				}
+				metadata := packStringMetadata(str, class)
+				limit := packResourceSizeRecommendation(cfg, class)
+				if limit > 0 && metadata.Size > limit {
+					problems = append(problems, packProblem{
+						Rule:     packRuleOversizedMedia,
+						Role:     role.ID,
+						String:   str.ID,
+						Class:    class,
+						Resource: id,
+						Message: fmt.Sprintf("%v of string %v/%v is %d bytes, more than %d",
+							class, role.ID, str.ID, metadata.Size, limit,
+						),
+					})
+				}
+				if isLegacyContentType(cfg, metadata.ContentType) {
+					contentType := metadata.ContentType
+					if contentType == "" {
+						contentType = "unknown"
+					}
+					problems = append(problems, packProblem{
+						Rule:     packRuleLegacyContentType,
+						Role:     role.ID,
+						String:   str.ID,
+						Class:    class,
+						Resource: id,
+						Message: fmt.Sprintf("%v of string %v/%v has legacy content type %v",
+							class, role.ID, str.ID, contentType,
+						),
+					})
+				}
+			}
+		}
+	}
+
+	// the same media used by more than one string, which players cannot tell apart
+	type mediaUse struct {
+		class    string
+		resource int64
+		strings  []string
+	}
+	var uses []*mediaUse
+	usesByDigest := make(map[string]*mediaUse)
+	for _, role := range pack.Roles {
+		for _, str := range role.Strings {
+			for _, class := range packResourceClasses {
+				id := packStringResource(str, class)
+				if id == 0 {
+					continue
+				}
+				// identical uploads share a resource, but older ones may not
+				digest := packStringMetadata(str, class).SHA256
+				if digest == "" {
+					digest = strconv.FormatInt(id, 10)
+				}
+				key := class + "/" + digest
+				use, ok := usesByDigest[key]
+				if !ok {
+					use = &mediaUse{class: class, resource: id}
+					usesByDigest[key] = use
+					uses = append(uses, use)
+				}
+				use.strings = append(use.strings, role.ID+"/"+str.ID)
+			}
+		}
+	}
+	for _, use := range uses {
+		if len(use.strings) > 1 {
+			problems = append(problems, packProblem{
+				Rule:     packRuleDuplicateMedia,
+				Class:    use.class,
+				Resource: use.resource,
+				Strings:  use.strings,
+				Message:  fmt.Sprintf("%v is shared by %d strings", use.class, len(use.strings)),
+			})
+		}
+	}
+
+	report := packValidationReport{Valid: true, Problems: make([]packProblem, 0, len(problems))}
+	for _, problem := range problems {
+		problem.Blocking = isBlockingPackRule(cfg, problem.Rule)
+		if problem.Blocking {
+			report.Valid = false
+		}
+		report.Problems = append(report.Problems, problem)
+	}
+	return report
+}
+
+func packStringResource(str packString, class string) int64 {
+	switch class {
+	case "image":
+		return str.Image
+	case "audio":
+		return str.Audio
+	case "text":
+		return str.Text
+	case "video":
+		return str.Video
+	}
+	return 0
+}
+
+func packStringMetadata(str packString, class string) resourceMetadata {
+	var metadata *resourceMetadata
+	switch class {
+	case "image":
+		metadata = str.ImageMetadata
+	case "audio":
+		metadata = str.AudioMetadata
+	case "text":
+		metadata = str.TextMetadata
+	case "video":
+		metadata = str.VideoMetadata
+	}
+	if metadata == nil {
+		return resourceMetadata{}
+	}
+	return *metadata
+}
+
+// the size above which a resource is reported as oversized, or zero
+func packResourceSizeRecommendation(cfg *config.Config, class string) int64 {
+	switch class {
+	case "image":
+		return cfg.Validation.MaxImageSize
+	case "audio":
+		return cfg.Validation.MaxAudioSize
+	case "video":
+		return cfg.Validation.MaxVideoSize
+	}
+	return 0
+}
+
+// content types that are configured as legacy, were not recorded, or are no
+// longer accepted for upload
+func isLegacyContentType(cfg *config.Config, contentType string) bool {
+	for _, legacy := range cfg.Validation.LegacyContentTypes {
+		if contentType == legacy {
+			return true
+		}
+	}
+	_, canonicalType, err := derivePackResourceClass(contentType)
+	return err != nil || canonicalType != contentType
+}
+
+func isBlockingPackRule(cfg *config.Config, rule string) bool {
+	for _, blocking := range cfg.Validation.BlockingRules {
+		if rule == blocking {
+			return true
+		}
+	}
+	return false
+}
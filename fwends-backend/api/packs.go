@@ -1,34 +1,57 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"fwends-backend/config"
+	"fwends-backend/game"
 	"fwends-backend/handler"
+	"fwends-backend/media"
 	"fwends-backend/util"
+	"hash"
+	"io"
+	"math"
+	"mime"
 	"net/http"
 	"regexp"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/go-redis/redis/v8"
 	"github.com/lib/pq"
+	"go.uber.org/zap"
 )
 
 /*
 Example curl commands:
 
 curl -X GET http://localhost:8080/api/packs/
+curl -X GET 'http://localhost:8080/api/packs/?tag=animals&tag=kids'
+curl -X GET 'http://localhost:8080/api/packs/?status=published&revision=published'
 curl -X POST http://localhost:8080/api/packs/ -d '{"title":"Test Pack"}'
+curl -X POST http://localhost:8080/api/packs/ -d '{"title":"Test Pack","description":"Some animals","tags":["animals"],"language":"en","ageRating":"everyone"}'
 curl -X GET http://localhost:8080/api/packs/6882582496895041536
 curl -X PUT http://localhost:8080/api/packs/6882582496895041536 -d '{"title":"Updated Test Pack"}'
+curl -X PATCH http://localhost:8080/api/packs/6882582496895041536 -d '{"tags":["animals","birds"],"cover":null}'
+curl -X POST http://localhost:8080/api/packs/6882582496895041536/cover -H 'Content-Type: image/png' --data-binary "@path/to/image.png"
+curl -X PUT http://localhost:8080/api/packs/6882582496895041536/role/string -H 'Content-Type: image/svg+xml' --data-binary "@path/to/image.svg"
 curl -X PUT http://localhost:8080/api/packs/6882582496895041536/role/string -H 'Content-Type: image/png' --data-binary "@path/to/image.png"
 curl -X PUT http://localhost:8080/api/packs/6882582496895041536/role/string -H 'Content-Type: audio/mpeg' --data-binary "@path/to/audio.mp3"
+curl -X PUT http://localhost:8080/api/packs/6882582496895041536/role/string -H 'Content-Type: audio/mpeg' -H "Repr-Digest: sha-256=:$(openssl dgst -sha256 -binary path/to/audio.mp3 | base64):" --data-binary "@path/to/audio.mp3"
+curl -X PUT http://localhost:8080/api/packs/6882582496895041536/role/string -H 'Content-Type: text/markdown' --data-binary "@path/to/caption.md"
+curl -X PUT http://localhost:8080/api/packs/6882582496895041536/role/string -H 'Content-Type: video/mp4' -T path/to/video.mp4
 curl -X DELETE http://localhost:8080/api/packs/6882582496895041536
 curl -X DELETE http://localhost:8080/api/packs/6882582496895041536/role
 curl -X DELETE http://localhost:8080/api/packs/6882582496895041536/role/string
@@ -36,85 +59,197 @@ curl -X DELETE http://localhost:8080/api/packs/6882582496895041536/role/string
 
 // GET /api/packs/
 //
-// Lists all existing packs.
-func ListPacks(cfg *config.Config, db *sql.DB) handler.Handler {
-	return &listPacksHandler{cfg, db}
+// Lists packs, optionally filtered to those having every given tag or a status.
+// Unauthenticated users, and those asking for the published revisions, are only
+// shown packs that are published, as they were when last published.
+func ListPacks(cfg *config.Config, db *sql.DB, rdb *redis.Client) handler.Handler {
+	return &listPacksHandler{cfg, db, rdb}
 }
 
 type listPacksHandler struct {
 	cfg *config.Config
 	db  *sql.DB
+	rdb *redis.Client
 }
 
 func (h *listPacksHandler) Handle(i handler.Input) (int, error) {
-	packs := make([]packSummary, 0)
+	query := i.Request.URL.Query()
+
+	// tags to filter by, a pack must have all of them
+	tags := make([]string, 0)
+	for _, tag := range query["tag"] {
+		tag, err := normalizePackTag(tag)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		tags = append(tags, tag)
+	}
+	var status sql.NullString
+	if query.Has("status") {
+		status = sql.NullString{String: query.Get("status"), Valid: true}
+		if !isPackStatus(status.String) {
+			return http.StatusBadRequest, fmt.Errorf("unrecognized pack status: %v", status.String)
+		}
+	}
+
+	authenticated, err := isAuthenticated(i.Request.Context(), h.cfg, h.rdb, i.Request)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	var packs []packSummary
+	if !authenticated || query.Get("revision") == "published" {
+		packs, err = h.listPublishedPacks(i.Request.Context(), tags, status)
+	} else {
+		packs, err = h.listPacks(i.Request.Context(), tags, status)
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	// respond to request
+	i.Response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(i.Response).Encode(packs)
 
-	rows, err := h.db.QueryContext(i.Request.Context(), `
+	return http.StatusOK, nil
+}
+
+func (h *listPacksHandler) listPacks(ctx context.Context, tags []string, status sql.NullString) ([]packSummary, error) {
+	rows, err := h.db.QueryContext(ctx, `
 		SELECT
 			packs.pack_id,
 			packs.title,
+			packs.description,
+			packs.tags,
+			packs.language,
+			packs.age_rating,
+			packs.cover_resource_id,
+			packs.required_classes,
 			packs.hash,
+			packs.status,
+			packs.revision,
+			COALESCE(packs.published_revision, 0),
 			COUNT(DISTINCT pack_resources.role_id),
 			COUNT(DISTINCT pack_resources.role_id || '-' || pack_resources.string_id)
 		FROM packs
 			LEFT OUTER JOIN pack_resources ON pack_resources.pack_id = packs.pack_id
+		WHERE packs.tags @> $1 AND ($2::text IS NULL OR packs.status::text = $2)
 		GROUP BY packs.pack_id
-	`)
+	`, pq.Array(tags), status)
 	if err != nil {
-		return http.StatusInternalServerError, err
+		return nil, err
 	}
 	defer rows.Close()
+	packs := make([]packSummary, 0)
 	for rows.Next() {
 		var pack packSummary
+		var cover sql.NullInt64
 		var hash []byte
-		err := rows.Scan(&pack.ID, &pack.Title, &hash, &pack.RoleCount, &pack.StringCount)
-		pack.Hash = hex.EncodeToString(hash)
+		err := rows.Scan(
+			&pack.ID, &pack.Title, &pack.Description, pq.Array(&pack.Tags), &pack.Language,
+			&pack.AgeRating, &cover, pq.Array(&pack.RequiredClasses), &hash,
+			&pack.Status, &pack.Revision, &pack.PublishedRevision, &pack.RoleCount, &pack.StringCount,
+		)
 		if err != nil {
-			return http.StatusInternalServerError, err
+			return nil, err
 		}
+		pack.Cover = cover.Int64
+		pack.Hash = hex.EncodeToString(hash)
 		packs = append(packs, pack)
 	}
-	rows.Close()
-
-	// respond to request
-	i.Response.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(i.Response).Encode(packs)
+	return packs, rows.Err()
+}
 
-	return http.StatusOK, nil
+// lists published packs as they were published, rather than any later drafts
+func (h *listPacksHandler) listPublishedPacks(ctx context.Context, tags []string, status sql.NullString) ([]packSummary, error) {
+	tagsJSON, err := json.Marshal(tags)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT packs.pack_id, packs.status, published_packs.revision, published_packs.pack
+		FROM packs
+			INNER JOIN published_packs ON published_packs.pack_id = packs.pack_id
+		WHERE
+			packs.status = 'published' AND
+			published_packs.pack->'tags' @> $1::jsonb AND
+			($2::text IS NULL OR packs.status::text = $2)
+	`, string(tagsJSON), status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	packs := make([]packSummary, 0)
+	for rows.Next() {
+		var pack packSummary
+		var snapshot []byte
+		err := rows.Scan(&pack.ID, &pack.Status, &pack.Revision, &snapshot)
+		if err != nil {
+			return nil, err
+		}
+		var details packDetails
+		err = json.Unmarshal(snapshot, &details)
+		if err != nil {
+			return nil, err
+		}
+		pack.packMetadata = details.packMetadata
+		pack.Hash = details.Hash
+		pack.PublishedRevision = pack.Revision
+		pack.RoleCount = len(details.Roles)
+		for _, role := range details.Roles {
+			pack.StringCount += len(role.Strings)
+		}
+		packs = append(packs, pack)
+	}
+	return packs, rows.Err()
 }
 
 // POST /api/packs/
 //
-// Creates an new pack with a title and returns the id.
-func CreatePack(db *sql.DB, idgen *util.SnowflakeGenerator) handler.Handler {
-	return &createPackHandler{db, idgen}
+// Creates an new pack with a title and optional metadata and returns the id.
+func CreatePack(cfg *config.Config, db *sql.DB, idgen *util.SnowflakeGenerator) handler.Handler {
+	return &createPackHandler{cfg, db, idgen}
 }
 
 type createPackHandler struct {
+	cfg   *config.Config
 	db    *sql.DB
 	idgen *util.SnowflakeGenerator
 }
 
 func (h *createPackHandler) Handle(i handler.Input) (int, error) {
 	// decode request body
-	decoder := json.NewDecoder(i.Request.Body)
-	var reqbody struct {
-		Title string `json:"title"`
+	var reqbody packMetadataPatch
+	status, err := decodeJSONBody(h.cfg, i.Request, &reqbody)
+	if err != nil {
+		return status, err
+	} else if reqbody.Title == nil {
+		return http.StatusBadRequest, errors.New("pack title is required")
+	} else if len(reqbody.Cover) > 0 {
+		return http.StatusBadRequest, errors.New("pack cover must be uploaded after the pack is created")
 	}
-	err := decoder.Decode(&reqbody)
+	err = reqbody.normalize()
 	if err != nil {
-		return http.StatusBadRequest, fmt.Errorf("failed to decode resonse body: %v", err)
-	} else if len(reqbody.Title) == 0 {
-		return http.StatusBadRequest, errors.New("empty pack title is not allowed")
+		return http.StatusBadRequest, err
 	}
 
 	// this id will be used for the life of pack
 	id := h.idgen.GenID()
 
-	// insert pack row in postgres
+	// insert pack row in postgres, omitted metadata uses the column defaults
 	_, err = h.db.ExecContext(i.Request.Context(),
-		"INSERT INTO packs (pack_id, title) VALUES ($1, $2)",
-		id, reqbody.Title,
+		`
+		INSERT INTO packs (pack_id, title, description, tags, language, age_rating, required_classes)
+		VALUES (
+			$1, $2,
+			COALESCE($3, ''),
+			COALESCE($4, '{}'),
+			COALESCE($5, 'und'),
+			COALESCE($6::agerating, 'everyone'),
+			COALESCE($7::resourceclass[], '{image,audio}')
+		)
+		`,
+		id, *reqbody.Title, reqbody.Description, pq.Array(reqbody.Tags), reqbody.Language, reqbody.AgeRating,
+		pq.Array(reqbody.RequiredClasses),
 	)
 	if err != nil {
 		return http.StatusInternalServerError, err
@@ -137,44 +272,45 @@ func (h *createPackHandler) Handle(i handler.Input) (int, error) {
 
 // GET /api/packs/:pack_id
 //
-// Gets a pack's title.
-func GetPack(cfg *config.Config, db *sql.DB) handler.Handler {
-	return &getPackHandler{cfg, db}
+// Gets a pack's metadata and resources. Resources are given by id, and by a fully
+// qualified url with their content type. urls expire if media urls are configured
+// to be presigned, otherwise they are under the configured media base url.
+// Unauthenticated users, and those asking for the published revision, get the pack
+// as it was last published, and packs that have not been published are not found.
+func GetPack(cfg *config.Config, db *sql.DB, rdb *redis.Client, s3p *s3.PresignClient) handler.Handler {
+	return &getPackHandler{cfg, db, rdb, mediaURLSigner{cfg, s3p}}
 }
 
 type getPackHandler struct {
-	cfg *config.Config
-	db  *sql.DB
+	cfg  *config.Config
+	db   *sql.DB
+	rdb  *redis.Client
+	urls mediaURLSigner
 }
 
 func (h *getPackHandler) Handle(i handler.Input) (int, error) {
 	packID := i.Params.ByName("pack_id")
 
 	var resbody struct {
-		Title string     `json:"title"`
-		Hash  string     `json:"hash"`
-		Roles []packRole `json:"roles"`
+		packDetails
+		packStatus
 	}
 
-	// start a new transaction to ensure consistent state
-	tx, err := h.db.BeginTx(i.Request.Context(), &sql.TxOptions{
-		Isolation: sql.LevelRepeatableRead,
-	})
+	authenticated, err := isAuthenticated(i.Request.Context(), h.cfg, h.rdb, i.Request)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
-	defer tx.Rollback()
-
-	// query postgres for pack title
-	resbody.Title, resbody.Hash, err = h.getPackDetails(i.Request.Context(), tx, packID)
+	if !authenticated || i.Request.URL.Query().Get("revision") == "published" {
+		resbody.packDetails, resbody.packStatus, err = readPublishedPack(i.Request.Context(), h.db, packID)
+	} else {
+		resbody.packDetails, resbody.packStatus, err = h.readPack(i.Request.Context(), packID)
+	}
 	if err == errPackNotFoundError {
 		return http.StatusNotFound, nil
 	} else if err != nil {
 		return http.StatusInternalServerError, err
 	}
-
-	// get pack resources
-	resbody.Roles, err = h.getPackResources(i.Request.Context(), tx, packID)
+	err = h.urls.packURLs(i.Request.Context(), &resbody.packDetails)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
@@ -186,34 +322,114 @@ func (h *getPackHandler) Handle(i handler.Input) (int, error) {
 	return http.StatusOK, nil
 }
 
-func (h *getPackHandler) getPackDetails(ctx context.Context, tx *sql.Tx, packID string) (string, string, error) {
+func (h *getPackHandler) readPack(ctx context.Context, packID string) (packDetails, packStatus, error) {
+	// start a new transaction to ensure consistent state
+	tx, err := h.db.BeginTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelRepeatableRead,
+	})
+	if err != nil {
+		return packDetails{}, packStatus{}, err
+	}
+	defer tx.Rollback()
+	return queryPackDetails(ctx, h.cfg, tx, packID)
+}
+
+// queries a pack's current revision, without resource urls
+func queryPackDetails(ctx context.Context, cfg *config.Config, tx *sql.Tx, packID string) (packDetails, packStatus, error) {
+	// query postgres for pack metadata
+	details, status, err := queryPackMetadata(ctx, tx, packID)
+	if err != nil {
+		return details, status, err
+	}
+
+	// get pack resources
+	details.Roles, err = queryPackResources(ctx, cfg, tx, packID)
+	if err != nil {
+		return details, status, err
+	}
+	err = queryPackImageVariants(ctx, tx, packID, details.Roles)
+	return details, status, err
+}
+
+// queries the metadata of a pack's current revision, without its roles
+func queryPackMetadata(ctx context.Context, tx *sql.Tx, packID string) (packDetails, packStatus, error) {
+	var details packDetails
+	var status packStatus
 	rows, err := tx.QueryContext(ctx,
-		"SELECT title, hash FROM packs WHERE pack_id = $1", packID,
+		`
+		SELECT
+			packs.title, packs.description, packs.tags, packs.language, packs.age_rating,
+			packs.cover_resource_id, COALESCE(resources.content_type, ''), packs.required_classes,
+			packs.hash, packs.status, packs.revision, COALESCE(packs.published_revision, 0)
+		FROM packs
+			LEFT OUTER JOIN resources ON resources.resource_id = packs.cover_resource_id
+		WHERE packs.pack_id = $1
+		`,
+		packID,
 	)
 	if err != nil {
-		return "", "", err
+		return details, status, err
 	}
 	defer rows.Close()
 	if !rows.Next() {
 		// no row was returned
-		return "", "", errPackNotFoundError
+		return details, status, errPackNotFoundError
 	}
-	var title string
+	var cover sql.NullInt64
 	var hash []byte
-	err = rows.Scan(&title, &hash)
+	err = rows.Scan(
+		&details.Title, &details.Description, pq.Array(&details.Tags),
+		&details.Language, &details.AgeRating, &cover, &details.CoverContentType,
+		pq.Array(&details.RequiredClasses), &hash,
+		&status.Status, &status.Revision, &status.PublishedRevision,
+	)
 	if err != nil {
-		return "", "", err
+		return details, status, err
 	}
-	return title, hex.EncodeToString(hash), nil
+	details.Cover = cover.Int64
+	details.Hash = hex.EncodeToString(hash)
+	return details, status, nil
 }
 
-func (h *getPackHandler) getPackResources(ctx context.Context, tx *sql.Tx, packID string) ([]packRole, error) {
-	// query postgres for pack resources
+func queryPackResources(ctx context.Context, cfg *config.Config, tx *sql.Tx, packID string) ([]packRole, error) {
+	// query postgres for pack resources, with the display properties of their roles and strings
 	rows, err := tx.QueryContext(ctx,
 		`
-		SELECT role_id, string_id, resource_class, resource_id
-		FROM pack_resources WHERE pack_id = $1
-		ORDER BY role_id, string_id
+		SELECT
+			pack_resources.role_id,
+			pack_resources.string_id,
+			pack_resources.resource_class,
+			pack_resources.resource_id,
+			COALESCE(resources.content_type, ''),
+			COALESCE(resources.width, 0),
+			COALESCE(resources.height, 0),
+			COALESCE(resources.duration_ms, 0),
+			COALESCE(resources.sample_rate, 0),
+			COALESCE(resources.channels, 0),
+			COALESCE(resources.size, 0),
+			resources.sha256,
+			resources.loudness_lufs,
+			resources.peak_dbfs,
+			COALESCE(resources.blurhash, ''),
+			COALESCE(pack_roles.label, ''),
+			COALESCE(pack_roles.position, 0),
+			COALESCE(pack_strings.label, ''),
+			COALESCE(pack_strings.position, 0)
+		FROM pack_resources
+			INNER JOIN resources ON resources.resource_id = pack_resources.resource_id
+			LEFT OUTER JOIN pack_roles ON
+				pack_roles.pack_id = pack_resources.pack_id AND
+				pack_roles.role_id = pack_resources.role_id
+			LEFT OUTER JOIN pack_strings ON
+				pack_strings.pack_id = pack_resources.pack_id AND
+				pack_strings.role_id = pack_resources.role_id AND
+				pack_strings.string_id = pack_resources.string_id
+		WHERE pack_resources.pack_id = $1
+		ORDER BY
+			COALESCE(pack_roles.position, 0),
+			pack_resources.role_id,
+			COALESCE(pack_strings.position, 0),
+			pack_resources.string_id
 		`,
 		packID,
 	)
@@ -229,26 +445,58 @@ func (h *getPackHandler) getPackResources(ctx context.Context, tx *sql.Tx, packI
 		var stringID string
 		var resourceClass string
 		var resourceID int64
-		err := rows.Scan(&roleID, &stringID, &resourceClass, &resourceID)
+		var metadata resourceMetadata
+		var durationMS int64
+		var digest []byte
+		var loudness sql.NullFloat64
+		var peak sql.NullFloat64
+		var blurHash string
+		var newRole packRole
+		var newString packString
+		err := rows.Scan(
+			&roleID, &stringID, &resourceClass, &resourceID, &metadata.ContentType,
+			&metadata.Width, &metadata.Height, &durationMS,
+			&metadata.SampleRate, &metadata.Channels, &metadata.Size, &digest, &loudness, &peak, &blurHash,
+			&newRole.Label, &newRole.Position, &newString.Label, &newString.Position,
+		)
 		if err != nil {
 			return nil, err
 		}
+		metadata.Duration = float64(durationMS) / 1000
+		metadata.SHA256 = hex.EncodeToString(digest)
+		if loudness.Valid && peak.Valid {
+			metadata.Loudness = roundedFloat(loudness.Float64, 1)
+			metadata.Peak = roundedFloat(peak.Float64, 1)
+		}
 		if roleID != prevRoleID {
-			roles = append(roles, packRole{
-				ID:      roleID,
-				Strings: []packString{{ID: stringID}},
-			})
+			newRole.ID = roleID
+			newString.ID = stringID
+			newRole.Strings = []packString{newString}
+			roles = append(roles, newRole)
 		} else if stringID != prevStringID {
+			newString.ID = stringID
 			role := &roles[len(roles)-1]
-			role.Strings = append(role.Strings, packString{ID: stringID})
+			role.Strings = append(role.Strings, newString)
 		}
 		role := &roles[len(roles)-1]
 		str := &role.Strings[len(role.Strings)-1]
 		switch resourceClass {
 		case "audio":
 			str.Audio = resourceID
+			str.AudioMetadata = &metadata
+			if loudness.Valid && peak.Valid {
+				str.AudioGain = roundedFloat(audioGain(cfg, loudness.Float64, peak.Float64), 1)
+			}
 		case "image":
 			str.Image = resourceID
+			str.ImageMetadata = &metadata
+			str.ImageBlurHash = blurHash
+		case "text":
+			str.Text = resourceID
+			str.TextMetadata = &metadata
+		case "video":
+			str.Video = resourceID
+			str.VideoMetadata = &metadata
 		}
 		prevRoleID = roleID
 		prevStringID = stringID
@@ -256,55 +504,130 @@ func (h *getPackHandler) getPackResources(ctx context.Context, tx *sql.Tx, packI
 	return roles, nil
 }
 
+// fills in the resized variants of each string's image, smallest first
+func queryPackImageVariants(ctx context.Context, tx *sql.Tx, packID string, roles []packRole) error {
+	rows, err := tx.QueryContext(ctx,
+		`
+		SELECT
+			resource_variants.resource_id,
+			resource_variants.variant_resource_id,
+			COALESCE(resources.content_type, ''),
+			resource_variants.width,
+			resource_variants.height
+		FROM pack_resources
+			INNER JOIN resource_variants ON resource_variants.resource_id = pack_resources.resource_id
+			LEFT OUTER JOIN resources ON resources.resource_id = resource_variants.variant_resource_id
+		WHERE pack_resources.pack_id = $1 AND pack_resources.resource_class = 'image'
+		ORDER BY resource_variants.width * resource_variants.height
+		`,
+		packID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	variants := make(map[int64][]imageVariant)
+	for rows.Next() {
+		var resourceID int64
+		var variant imageVariant
+		err := rows.Scan(&resourceID, &variant.ID, &variant.ContentType, &variant.Width, &variant.Height)
+		if err != nil {
+			return err
+		}
+		variants[resourceID] = append(variants[resourceID], variant)
+	}
+	for i := range roles {
+		for j := range roles[i].Strings {
+			str := &roles[i].Strings[j]
+			str.ImageVariants = variants[str.Image]
+		}
+	}
+	return rows.Err()
+}
+
 // PUT /api/packs/:pack_id
+// PATCH /api/packs/:pack_id
 //
-// Updates a pack's title.
-func UpdatePack(db *sql.DB) handler.Handler {
-	return &updatePackHandler{db}
+// Updates a pack's metadata, fields omitted from the request are left unchanged.
+func UpdatePack(cfg *config.Config, db *sql.DB, s3c *s3.Client) handler.Handler {
+	return &updatePackHandler{packResourceHandler{cfg, db, s3c}}
 }
 
 type updatePackHandler struct {
-	db *sql.DB
+	packResourceHandler
 }
 
 func (h *updatePackHandler) Handle(i handler.Input) (int, error) {
 	packID := i.Params.ByName("pack_id")
 
 	// decode request body
-	decoder := json.NewDecoder(i.Request.Body)
-	var reqbody struct {
-		Title string `json:"title"`
+	var reqbody packMetadataPatch
+	status, err := decodeJSONBody(h.cfg, i.Request, &reqbody)
+	if err != nil {
+		return status, err
 	}
-	err := decoder.Decode(&reqbody)
+	err = reqbody.normalize()
 	if err != nil {
-		return http.StatusBadRequest, fmt.Errorf("failed to decode resonse body: %v", err)
-	} else if len(reqbody.Title) == 0 {
-		return http.StatusBadRequest, errors.New("empty pack title is not allowed")
+		return http.StatusBadRequest, err
 	}
 
-	// update pack title
-	res, err := h.db.ExecContext(i.Request.Context(),
-		"UPDATE packs SET title = $2 WHERE pack_id = $1", packID, reqbody.Title,
+	// update pack metadata, returning the previous cover so it can be pruned
+	rows, err := h.db.QueryContext(i.Request.Context(),
+		`
+		WITH previous AS (
+			SELECT pack_id, cover_resource_id FROM packs WHERE pack_id = $1 FOR UPDATE
+		)
+		UPDATE packs SET
+			title = COALESCE($2, packs.title),
+			description = COALESCE($3, packs.description),
+			tags = COALESCE($4, packs.tags),
+			language = COALESCE($5, packs.language),
+			age_rating = COALESCE($6::agerating, packs.age_rating),
+			required_classes = COALESCE($8::resourceclass[], packs.required_classes),
+			cover_resource_id = CASE WHEN $7 THEN NULL ELSE packs.cover_resource_id END,
+			-- edits to the published revision start a new draft revision
+			revision = CASE
+				WHEN packs.revision = packs.published_revision THEN packs.revision + 1
+				ELSE packs.revision
+			END
+		FROM previous
+		WHERE packs.pack_id = previous.pack_id
+		RETURNING previous.cover_resource_id
+		`,
+		packID, reqbody.Title, reqbody.Description, pq.Array(reqbody.Tags),
+		reqbody.Language, reqbody.AgeRating, reqbody.clearCover(), pq.Array(reqbody.RequiredClasses),
 	)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
+	defer rows.Close()
 
 	// check whether anything was updated
-	affected, err := res.RowsAffected()
-	if err != nil {
-		return http.StatusInternalServerError, err
-	} else if affected != 1 {
+	if !rows.Next() {
 		// row was not changed, the pack does not exist
 		return http.StatusNotFound, nil
 	}
+	var previousCover sql.NullInt64
+	err = rows.Scan(&previousCover)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	rows.Close()
+
+	// prune the cover if it was removed
+	if reqbody.clearCover() && previousCover.Valid {
+		go h.pruneResource(context.Background(), strconv.FormatInt(previousCover.Int64, 10))
+	}
 
 	return http.StatusOK, nil
 }
 
 // PUT /api/packs/:pack_id/:role_id/:string_id
 //
-// Adds or replaces a image or audio pack resource.
+// Adds or replaces a image, audio, video or text pack resource. The body is
+// verified against a Content-MD5, Digest or Repr-Digest header if one is sent, and
+// the sha-256 digest of the resource as stored is returned in a Repr-Digest header.
+// Images may be stored without metadata, so that digest can differ from the body's.
 func UploadPackResource(cfg *config.Config, db *sql.DB, s3c *s3.Client, idgen *util.SnowflakeGenerator) handler.Handler {
 	return &uploadPackResourceHandler{idgen, packResourceHandler{cfg, db, s3c}}
 }
@@ -327,12 +650,76 @@ func (h *uploadPackResourceHandler) Handle(i handler.Input) (int, error) {
 		return http.StatusBadRequest, fmt.Errorf("failed to validate string id: %v", stringID)
 	}
 
-	// determine whether upload is audio or image
-	contentType := i.Request.Header.Get("Content-Type")
-	resourceClass, err := derivePackResourceClass(contentType)
+	// determine whether upload is audio, image, video or text
+	resourceClass, contentType, err := derivePackResourceClass(i.Request.Header.Get("Content-Type"))
 	if err != nil {
 		return http.StatusBadRequest, err
 	}
+	// reject uploads that are too large upfront if possible, otherwise while streaming
+	sizeLimit := packResourceSizeLimit(h.cfg, resourceClass)
+	errTooLarge := handler.NewPublicError(
+		fmt.Errorf("%v pack resource exceeds %d bytes", resourceClass, sizeLimit),
+	)
+	if i.Request.ContentLength > sizeLimit {
+		return http.StatusRequestEntityTooLarge, errTooLarge
+	}
+	limitedBody := util.NewLimitedReader(i.Request.Body, sizeLimit)
+
+	// verify the body against any digests the client sent
+	digests, err := parseRequestDigests(i.Request.Header)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	verifiedBody := util.NewVerifyingReader(limitedBody, i.Request.ContentLength, digests)
+	errDigestMismatch := handler.NewPublicError(errors.New("pack resource does not match its digest"))
+
+	// text is small, so it is read upfront to validate its encoding
+	var body io.Reader = verifiedBody
+	contentLength := i.Request.ContentLength
+	if resourceClass == "text" {
+		text, err := readTextResource(verifiedBody)
+		if limitedBody.Exceeded() {
+			return http.StatusRequestEntityTooLarge, errTooLarge
+		} else if verifiedBody.Mismatched() {
+			return http.StatusBadRequest, errDigestMismatch
+		} else if err == errTextResourceEncoding {
+			return http.StatusBadRequest, err
+		} else if err != nil {
+			return http.StatusBadRequest, fmt.Errorf("failed to read request body: %v", err)
+		}
+		body = bytes.NewReader(text)
+		contentLength = int64(len(text))
+	} else {
+		// check the leading bytes are really of the declared content type
+		body, err = sniffResource(body, contentType)
+		if limitedBody.Exceeded() {
+			return http.StatusRequestEntityTooLarge, errTooLarge
+		} else if verifiedBody.Mismatched() {
+			return http.StatusBadRequest, errDigestMismatch
+		} else if err == errResourceContentMismatch {
+			return http.StatusUnsupportedMediaType, err
+		} else if err != nil {
+			return http.StatusBadRequest, fmt.Errorf("failed to read request body: %v", err)
+		}
+	}
+
+	// strip active content from svgs and identifying metadata from photos
+	removed := []string{}
+	var image []byte
+	if resourceClass == "image" {
+		image, removed, err = sanitizeImageResource(h.cfg, body, contentType)
+		if limitedBody.Exceeded() {
+			return http.StatusRequestEntityTooLarge, errTooLarge
+		} else if verifiedBody.Mismatched() {
+			return http.StatusBadRequest, errDigestMismatch
+		} else if err != nil {
+			return http.StatusBadRequest, err
+		}
+		if image != nil {
+			body = bytes.NewReader(image)
+			contentLength = int64(len(image))
+		}
+	}
 
 	// check whether pack exists
 	packExists, err := h.packExists(i.Request.Context(), packID)
@@ -353,36 +740,77 @@ func (h *uploadPackResourceHandler) Handle(i handler.Input) (int, error) {
 	}()
 
 	// upload the resource to s3
-	err = h.uploadResource(i.Request, resourceID)
+	err = h.uploadResource(i.Request.Context(), resourceID, body, contentLength, contentType)
+	if limitedBody.Exceeded() {
+		return http.StatusRequestEntityTooLarge, errTooLarge
+	} else if verifiedBody.Mismatched() {
+		return http.StatusBadRequest, errDigestMismatch
+	} else if errors.Is(err, errResourceMetadata) {
+		return http.StatusBadRequest, err
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	// the whole body must have been read for it to be verified
+	if verifiedBody.Verify() != nil {
+		return http.StatusBadRequest, errDigestMismatch
+	}
+
+	// reuse an identical resource if there is one, taking over its variants and such
+	dedupedResourceID, err := h.dedupeResource(i.Request.Context(), resourceID)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
+	deduplicated := dedupedResourceID != resourceID
+	resourceID = dedupedResourceID
 
-	// loop that will retry if transaction serialization anomaly occurs
-	for !transactionCommited {
-		prevResourceID, err := h.updateResourceIDTransaction(i.Request.Context(),
-			packID, roleID, stringID, resourceClass, resourceID,
-		)
-		if isRetryableSerializationFailure(err) {
-			continue
-		} else if err == errPackNotFoundError {
-			return http.StatusNotFound, err
-		} else if err != nil {
+	// resized variants are pruned along with the resource if the transaction fails
+	if image != nil && !deduplicated {
+		variants, err := h.uploadImageVariants(i.Request.Context(), i.Logger, resourceID, contentType, image)
+		if err != nil {
 			return http.StatusInternalServerError, err
 		}
-		transactionCommited = true
-		if prevResourceID != "" {
-			go h.pruneResource(context.Background(), prevResourceID)
+		// the smallest variant is much quicker to decode than the original
+		placeholderSource, placeholderType := image, contentType
+		if len(variants) > 0 {
+			placeholderSource, placeholderType = variants[0].Data, variants[0].ContentType
 		}
+		err = h.saveImageBlurHash(i.Request.Context(), i.Logger, resourceID, placeholderType, placeholderSource)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	// the digest of what is stored and served, which differs from what was received
+	// when images are sanitized
+	var storedDigest []byte
+	err = h.db.QueryRowContext(i.Request.Context(),
+		"SELECT sha256 FROM resources WHERE resource_id = $1", resourceID,
+	).Scan(&storedDigest)
+	if err != nil {
+		return http.StatusInternalServerError, err
 	}
 
-	// repond with new resource id
+	// link the resource to the pack string, replacing any previous one
+	err = h.linkPackResource(i.Request.Context(), packID, roleID, stringID, resourceClass, resourceID, "")
+	if err == errPackNotFoundError {
+		return http.StatusNotFound, err
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	transactionCommited = true
+
+	// repond with new resource id, and what was removed from it
 	i.Response.Header().Set("Content-Type", "application/json")
+	i.Response.Header().Set("Repr-Digest",
+		"sha-256=:"+base64.StdEncoding.EncodeToString(storedDigest)+":",
+	)
+	setRemovedContentHeader(i.Response.Header(), removed)
 	json.NewEncoder(i.Response).Encode(resourceID)
 	return http.StatusOK, nil
 }
 
-func (h *uploadPackResourceHandler) packExists(ctx context.Context, packID string) (bool, error) {
+func (h *packResourceHandler) packExists(ctx context.Context, packID string) (bool, error) {
 	rows, err := h.db.QueryContext(ctx,
 		"SELECT 1 FROM packs WHERE pack_id = $1", packID,
 	)
@@ -393,31 +821,362 @@ func (h *uploadPackResourceHandler) packExists(ctx context.Context, packID strin
 	return rows.Next(), nil
 }
 
-func (h *uploadPackResourceHandler) uploadResource(r *http.Request, resourceID string) error {
-	// insert row to mark possble existance of resource in s3
-	_, err := h.db.ExecContext(r.Context(),
-		"INSERT INTO resources (resource_id) VALUES ($1)", resourceID,
-	)
-	if err != nil {
-		return err
-	}
+var errResourceMetadata = errors.New("failed to read resource metadata")
+
+// uploads a resource to s3, reading its metadata and taking its size and hash as
+// it streams, which are then saved to its row in the resources table
+func (h *packResourceHandler) uploadResource(
+	ctx context.Context, resourceID string, body io.Reader, contentLength int64, contentType string,
+) error {
+	// insert row to mark possble existance of resource in s3, the upload holds its
+	// first reference until it is linked to a pack, or pruned
+	_, err := h.db.ExecContext(ctx,
+		"INSERT INTO resources (resource_id, content_type, ref_count) VALUES ($1, $2, 1)",
+		resourceID, contentType,
+	)
+	if err != nil {
+		return err
+	}
+	return h.analyzeResource(ctx, resourceID, body, contentType, func(body io.Reader) error {
+		return h.putResource(ctx, resourceID, body, contentLength, contentType)
+	})
+}
+
+// reads the metadata of a resource and takes its size and hash while it is consumed,
+// such as by being uploaded to s3, which are then saved to its row in the resources
+// table. audio is also analyzed for its waveform and loudness.
+func (h *packResourceHandler) analyzeResource(
+	ctx context.Context, resourceID string, body io.Reader, contentType string, consume func(io.Reader) error,
+) error {
+	digest := &resourceDigest{hash: sha256.New()}
+	var metadata media.Metadata
+	body, probe := util.NewTap(io.TeeReader(body, digest), func(r io.Reader) (err error) {
+		metadata, err = media.Probe(contentType, r)
+		if err == media.ErrUnsupported {
+			// resources of other types have no metadata
+			return nil
+		}
+		return err
+	})
+	var analysis media.AudioAnalysis
+	body, analyze := util.NewTap(body, func(r io.Reader) (err error) {
+		analysis, err = media.AnalyzeAudio(contentType, r, resourceWaveformPeaks)
+		return err
+	})
+	err := consume(body)
+	analysisErr := analyze.Close(err)
+	probeErr := probe.Close(err)
+	if err != nil {
+		return err
+	} else if probeErr != nil {
+		return fmt.Errorf("%w: %v", errResourceMetadata, probeErr)
+	}
+
+	err = h.saveResourceMetadata(ctx, resourceID, metadata, digest)
+	if err != nil {
+		return err
+	}
+
+	// audio that cannot be decoded, such as aac or mpeg layer 2, is left unanalyzed
+	if analysisErr != nil {
+		return nil
+	}
+	return h.saveResourceAnalysis(ctx, resourceID, analysis)
+}
+
+func (h *packResourceHandler) putResource(
+	ctx context.Context, resourceID string, body io.Reader, contentLength int64, contentType string,
+) error {
+	// large or unknown length resources are uploaded in parts
+	if contentLength < 0 || contentLength > multipartUploadPartSize {
+		return h.uploadResourceMultipart(ctx, resourceID, body, contentType)
+	}
+
+	// upload resource to s3
+	_, err := h.s3c.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        &h.cfg.S3.MediaBucket,
+		Key:           &resourceID,
+		Body:          body,
+		ContentLength: contentLength,
+		ContentType:   &contentType,
+	}, s3.WithAPIOptions(
+		v4.SwapComputePayloadSHA256ForUnsignedPayloadMiddleware,
+	))
+	return err
+}
+
+// looks for a resource with the same content and type as an uploaded one, which is
+// already in use by a pack. if found, a reference is taken to it, the upload is
+// pruned and the id of the existing resource is returned, otherwise the id of the
+// upload is returned. resources not yet in use are never matched, which leaves out
+// variants and other uploads in progress.
+func (h *packResourceHandler) dedupeResource(ctx context.Context, resourceID string) (string, error) {
+	// begin a new transcation
+	tx, err := h.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	// lock the existing resource so it cannot be pruned before it is referenced
+	var existingID string
+	err = tx.QueryRowContext(ctx,
+		`
+		SELECT existing.resource_id
+		FROM resources AS uploaded
+			INNER JOIN resources AS existing ON
+				existing.sha256 = uploaded.sha256 AND
+				existing.content_type = uploaded.content_type AND
+				existing.resource_id <> uploaded.resource_id
+		WHERE uploaded.resource_id = $1 AND (
+			EXISTS (SELECT 1 FROM pack_resources WHERE resource_id = existing.resource_id) OR
+			EXISTS (SELECT 1 FROM packs WHERE cover_resource_id = existing.resource_id)
+		)
+		ORDER BY existing.resource_id
+		LIMIT 1
+		FOR UPDATE OF existing
+		`,
+		resourceID,
+	).Scan(&existingID)
+	if err == sql.ErrNoRows {
+		return resourceID, nil
+	} else if err != nil {
+		return "", err
+	}
+	_, err = tx.ExecContext(ctx,
+		"UPDATE resources SET ref_count = ref_count + 1 WHERE resource_id = $1", existingID,
+	)
+	if err != nil {
+		return "", err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return "", err
+	}
+
+	go h.pruneResource(context.Background(), resourceID)
+	return existingID, nil
+}
+
+// s3 requires parts other than the last to be at least 5 MiB
+const multipartUploadPartSize = 8 * 1024 * 1024
+
+func (h *packResourceHandler) uploadResourceMultipart(
+	ctx context.Context, resourceID string, body io.Reader, contentType string,
+) error {
+	upload, err := h.s3c.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      &h.cfg.S3.MediaBucket,
+		Key:         &resourceID,
+		ContentType: &contentType,
+	})
+	if err != nil {
+		return err
+	}
+
+	// abort the upload so s3 discards the parts, in-case it does not complete
+	completed := false
+	defer func() {
+		if !completed {
+			go h.s3c.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+				Bucket:   &h.cfg.S3.MediaBucket,
+				Key:      &resourceID,
+				UploadId: upload.UploadId,
+			})
+		}
+	}()
+
+	// upload one part at a time, there is always at least one part even if empty
+	parts := make([]types.CompletedPart, 0)
+	buffer := make([]byte, multipartUploadPartSize)
+	for partNumber := int32(1); ; partNumber++ {
+		n, readErr := io.ReadFull(body, buffer)
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			return readErr
+		}
+		if n > 0 || partNumber == 1 {
+			part, err := h.s3c.UploadPart(ctx, &s3.UploadPartInput{
+				Bucket:        &h.cfg.S3.MediaBucket,
+				Key:           &resourceID,
+				UploadId:      upload.UploadId,
+				PartNumber:    partNumber,
+				Body:          bytes.NewReader(buffer[:n]),
+				ContentLength: int64(n),
+			}, s3.WithAPIOptions(
+				v4.SwapComputePayloadSHA256ForUnsignedPayloadMiddleware,
+			))
+			if err != nil {
+				return err
+			}
+			parts = append(parts, types.CompletedPart{ETag: part.ETag, PartNumber: partNumber})
+		}
+		if readErr != nil {
+			break
+		}
+	}
+
+	_, err = h.s3c.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          &h.cfg.S3.MediaBucket,
+		Key:             &resourceID,
+		UploadId:        upload.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return err
+	}
+	completed = true
+	return nil
+}
+
+// longest side of the resized variants generated for image resources
+var imageVariantSizes = []int{128, 512, 1024}
+
+// generates resized variants of an image, and uploads them as resources of their
+// own. images that cannot be resized are logged and otherwise left without variants.
+func (h *uploadPackResourceHandler) uploadImageVariants(
+	ctx context.Context, logger *zap.Logger, resourceID string, contentType string, image []byte,
+) ([]media.Variant, error) {
+	variants, err := media.GenerateVariants(contentType, image, imageVariantSizes)
+	if err == media.ErrUnsupported {
+		return nil, nil
+	} else if err != nil {
+		logger.With(zap.Error(err), zap.String("resource_id", resourceID)).
+			Warn("failed to generate image variants")
+		return nil, nil
+	}
+	for _, variant := range variants {
+		variantID := strconv.FormatInt(h.idgen.GenID(), 10)
+		err := h.uploadResource(ctx, variantID, bytes.NewReader(variant.Data),
+			int64(len(variant.Data)), variant.ContentType,
+		)
+		if err == nil {
+			_, err = h.db.ExecContext(ctx,
+				`
+				INSERT INTO resource_variants (resource_id, variant_resource_id, width, height)
+				VALUES ($1, $2, $3, $4)
+				`,
+				resourceID, variantID, variant.Width, variant.Height,
+			)
+		}
+		if err != nil {
+			// not yet linked to the resource, so it is pruned on its own
+			go h.pruneResource(context.Background(), variantID)
+			return nil, err
+		}
+	}
+	return variants, nil
+}
+
+// encodes a placeholder for an image resource, from the image itself or any of its
+// variants. images that cannot be decoded are logged and otherwise left without one.
+func (h *packResourceHandler) saveImageBlurHash(
+	ctx context.Context, logger *zap.Logger, resourceID string, contentType string, image []byte,
+) error {
+	blurHash, err := media.BlurHash(contentType, image)
+	if err == media.ErrUnsupported {
+		return nil
+	} else if err != nil {
+		logger.With(zap.Error(err), zap.String("resource_id", resourceID)).
+			Warn("failed to encode image blurhash")
+		return nil
+	}
+	_, err = h.db.ExecContext(ctx,
+		"UPDATE resources SET blurhash = $2 WHERE resource_id = $1", resourceID, blurHash,
+	)
+	return err
+}
+
+func (h *packResourceHandler) saveResourceMetadata(
+	ctx context.Context, resourceID string, metadata media.Metadata, digest *resourceDigest,
+) error {
+	_, err := h.db.ExecContext(ctx,
+		`
+		UPDATE resources SET
+			width = NULLIF($2, 0),
+			height = NULLIF($3, 0),
+			duration_ms = NULLIF($4, 0),
+			sample_rate = NULLIF($5, 0),
+			channels = NULLIF($6, 0),
+			size = $7,
+			sha256 = $8
+		WHERE resource_id = $1
+		`,
+		resourceID, metadata.Width, metadata.Height, metadata.Duration.Milliseconds(),
+		metadata.SampleRate, metadata.Channels, digest.size, digest.hash.Sum(nil),
+	)
+	return err
+}
+
+// how many peaks are kept of an audio resource's waveform, shorter audio has fewer
+const resourceWaveformPeaks = 1024
+
+// waveform peaks are stored a byte each, which is plenty for drawing. loudness and
+// peak are left null for silence, where they are negative infinity.
+func (h *packResourceHandler) saveResourceAnalysis(
+	ctx context.Context, resourceID string, analysis media.AudioAnalysis,
+) error {
+	quantized := make([]byte, len(analysis.Peaks))
+	for i, peak := range analysis.Peaks {
+		quantized[i] = byte(math.Round(peak * 255))
+	}
+	// resumable uploads are analyzed again if finalizing them is retried
+	_, err := h.db.ExecContext(ctx,
+		`
+		INSERT INTO resource_waveforms (resource_id, peaks) VALUES ($1, $2)
+		ON CONFLICT (resource_id) DO UPDATE SET peaks = $2
+		`,
+		resourceID, quantized,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = h.db.ExecContext(ctx,
+		"UPDATE resources SET loudness_lufs = $2, peak_dbfs = $3 WHERE resource_id = $1",
+		resourceID, finiteOrNull(analysis.Loudness), finiteOrNull(analysis.Peak),
+	)
+	return err
+}
+
+func finiteOrNull(f float64) sql.NullFloat64 {
+	return sql.NullFloat64{Float64: f, Valid: !math.IsInf(f, 0) && !math.IsNaN(f)}
+}
+
+// counts and hashes the bytes of a resource as they are written
+type resourceDigest struct {
+	hash hash.Hash
+	size int64
+}
 
-	// upload resource to s3
-	contentType := r.Header.Get("Content-Type")
-	_, err = h.s3c.PutObject(r.Context(), &s3.PutObjectInput{
-		Bucket:        &h.cfg.S3.MediaBucket,
-		Key:           &resourceID,
-		Body:          r.Body,
-		ContentLength: r.ContentLength,
-		ContentType:   &contentType,
-	}, s3.WithAPIOptions(
-		v4.SwapComputePayloadSHA256ForUnsignedPayloadMiddleware,
-	))
-	return err
+func (d *resourceDigest) Write(p []byte) (int, error) {
+	d.size += int64(len(p))
+	return d.hash.Write(p)
+}
+
+// links a resource to a pack string, retrying if a transaction serialization anomaly
+// occurs. the resource it replaces, if any, is pruned. the upload session the
+// resource came from, if given, is ended in the same transaction.
+func (h *packResourceHandler) linkPackResource(
+	ctx context.Context, packID string, roleID string, stringID string, resourceClass string, resourceID string,
+	uploadID string,
+) error {
+	for {
+		prevResourceID, err := h.updateResourceIDTransaction(ctx,
+			packID, roleID, stringID, resourceClass, resourceID, uploadID,
+		)
+		if isRetryableSerializationFailure(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if prevResourceID != "" {
+			go h.pruneResource(context.Background(), prevResourceID)
+		}
+		return nil
+	}
 }
 
-func (h *uploadPackResourceHandler) updateResourceIDTransaction(
+func (h *packResourceHandler) updateResourceIDTransaction(
 	ctx context.Context, packID string, roleID string, stringID string, resourceClass string, resourceID string,
+	uploadID string,
 ) (string, error) {
 	// begin a new transcation
 	tx, err := h.db.BeginTx(ctx, &sql.TxOptions{
@@ -496,6 +1255,22 @@ func (h *uploadPackResourceHandler) updateResourceIDTransaction(
 			return "", err
 		}
 	}
+	_, err = tx.ExecContext(ctx, revisePackStatement, packID)
+	if err != nil {
+		return "", err
+	}
+
+	// end upload session
+	if uploadID != "" {
+		result, err := tx.ExecContext(ctx, "DELETE FROM upload_sessions WHERE upload_id = $1", uploadID)
+		if err != nil {
+			return "", err
+		}
+		rowsAffected, _ := result.RowsAffected()
+		if rowsAffected != 1 {
+			return "", errUploadNotFound
+		}
+	}
 
 	// commit transaction
 	err = tx.Commit()
@@ -511,6 +1286,137 @@ func (h *uploadPackResourceHandler) updateResourceIDTransaction(
 	return "", nil
 }
 
+// POST /api/packs/:pack_id/cover
+//
+// Adds or replaces a pack's cover image.
+func UploadPackCover(cfg *config.Config, db *sql.DB, s3c *s3.Client, idgen *util.SnowflakeGenerator) handler.Handler {
+	return &uploadPackCoverHandler{idgen, packResourceHandler{cfg, db, s3c}}
+}
+
+type uploadPackCoverHandler struct {
+	idgen *util.SnowflakeGenerator
+	packResourceHandler
+}
+
+func (h *uploadPackCoverHandler) Handle(i handler.Input) (int, error) {
+	packID := i.Params.ByName("pack_id")
+
+	// covers must be images
+	resourceClass, contentType, err := derivePackResourceClass(i.Request.Header.Get("Content-Type"))
+	if err != nil {
+		return http.StatusBadRequest, err
+	} else if resourceClass != "image" {
+		return http.StatusBadRequest, errors.New("pack cover must be an image")
+	}
+	sizeLimit := packResourceSizeLimit(h.cfg, resourceClass)
+	errTooLarge := handler.NewPublicError(fmt.Errorf("pack cover exceeds %d bytes", sizeLimit))
+	if i.Request.ContentLength > sizeLimit {
+		return http.StatusRequestEntityTooLarge, errTooLarge
+	}
+	limitedBody := util.NewLimitedReader(i.Request.Body, sizeLimit)
+
+	// check the leading bytes are really of the declared content type
+	body, err := sniffResource(limitedBody, contentType)
+	if limitedBody.Exceeded() {
+		return http.StatusRequestEntityTooLarge, errTooLarge
+	} else if err == errResourceContentMismatch {
+		return http.StatusUnsupportedMediaType, err
+	} else if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("failed to read request body: %v", err)
+	}
+
+	// strip active content from svgs and identifying metadata from photos
+	image, removed, err := sanitizeImageResource(h.cfg, body, contentType)
+	if limitedBody.Exceeded() {
+		return http.StatusRequestEntityTooLarge, errTooLarge
+	} else if err != nil {
+		return http.StatusBadRequest, err
+	}
+	contentLength := i.Request.ContentLength
+	if image != nil {
+		body = bytes.NewReader(image)
+		contentLength = int64(len(image))
+	}
+
+	// check whether pack exists
+	packExists, err := h.packExists(i.Request.Context(), packID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !packExists {
+		return http.StatusNotFound, nil
+	}
+
+	// defer prune the resource, in-case the update does not complete
+	resourceID := strconv.FormatInt(h.idgen.GenID(), 10)
+	updated := false
+	defer func() {
+		if !updated {
+			go h.pruneResource(context.Background(), resourceID)
+		}
+	}()
+
+	// upload the resource to s3
+	err = h.uploadResource(i.Request.Context(), resourceID, body, contentLength, contentType)
+	if limitedBody.Exceeded() {
+		return http.StatusRequestEntityTooLarge, errTooLarge
+	} else if errors.Is(err, errResourceMetadata) {
+		return http.StatusBadRequest, err
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	// reuse an identical resource if there is one
+	resourceID, err = h.dedupeResource(i.Request.Context(), resourceID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	// swap the cover, returning the previous one so it can be pruned
+	rows, err := h.db.QueryContext(i.Request.Context(),
+		`
+		WITH previous AS (
+			SELECT pack_id, cover_resource_id FROM packs WHERE pack_id = $1 FOR UPDATE
+		)
+		UPDATE packs SET
+			cover_resource_id = $2,
+			-- edits to the published revision start a new draft revision
+			revision = CASE
+				WHEN packs.revision = packs.published_revision THEN packs.revision + 1
+				ELSE packs.revision
+			END
+		FROM previous
+		WHERE packs.pack_id = previous.pack_id
+		RETURNING previous.cover_resource_id
+		`,
+		packID, resourceID,
+	)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		// no row returned, the pack was deleted during upload
+		return http.StatusNotFound, errPackNotFoundError
+	}
+	updated = true
+	var previousCover sql.NullInt64
+	err = rows.Scan(&previousCover)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	rows.Close()
+	if previousCover.Valid {
+		go h.pruneResource(context.Background(), strconv.FormatInt(previousCover.Int64, 10))
+	}
+
+	// repond with new resource id, and what was removed from it
+	i.Response.Header().Set("Content-Type", "application/json")
+	setRemovedContentHeader(i.Response.Header(), removed)
+	json.NewEncoder(i.Response).Encode(resourceID)
+	return http.StatusOK, nil
+}
+
 // DELETE /api/packs/:pack_id
 //
 // Deletes a pack and its ascociated resources.
@@ -570,14 +1476,57 @@ func (h *deletePackHandler) transaction(ctx context.Context, packID string) ([]s
 		}
 		resourcesDeleted = append(resourcesDeleted, resourceID)
 	}
+	rows.Close()
 
-	// delete pack resources and returns the resource ids
-	_, err = tx.ExecContext(ctx,
-		"DELETE FROM packs WHERE pack_id = $1", packID,
+	// delete role and string display properties
+	_, err = tx.ExecContext(ctx, "DELETE FROM pack_strings WHERE pack_id = $1", packID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM pack_roles WHERE pack_id = $1", packID)
+	if err != nil {
+		return nil, err
+	}
+
+	// delete the published revision, which holds references to its own resources
+	rows, err = tx.QueryContext(ctx,
+		"DELETE FROM published_packs WHERE pack_id = $1 RETURNING resource_ids", packID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		var publishedResourceIDs []int64
+		err := rows.Scan(pq.Array(&publishedResourceIDs))
+		if err != nil {
+			return nil, err
+		}
+		for _, resourceID := range publishedResourceIDs {
+			resourcesDeleted = append(resourcesDeleted, strconv.FormatInt(resourceID, 10))
+		}
+	}
+	rows.Close()
+
+	// delete the pack and get its cover id for pruning
+	rows, err = tx.QueryContext(ctx,
+		"DELETE FROM packs WHERE pack_id = $1 RETURNING cover_resource_id", packID,
 	)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+	if rows.Next() {
+		var cover sql.NullInt64
+		err := rows.Scan(&cover)
+		if err != nil {
+			return nil, err
+		}
+		if cover.Valid {
+			resourcesDeleted = append(resourcesDeleted, strconv.FormatInt(cover.Int64, 10))
+		}
+	}
+	rows.Close()
 
 	// commit transaction
 	err = tx.Commit()
@@ -649,6 +1598,20 @@ func (h *deletePackRoleHandler) transaction(ctx context.Context, packID string,
 	}
 	rows.Close()
 
+	// delete role and string display properties
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM pack_strings WHERE pack_id = $1 AND role_id = $2", packID, roleID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM pack_roles WHERE pack_id = $1 AND role_id = $2", packID, roleID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
 	// recompute the pack hash if anything was deleted
 	if len(resourcesDeleted) > 0 {
 		err = h.updatePackHash(ctx, tx, packID)
@@ -656,6 +1619,10 @@ func (h *deletePackRoleHandler) transaction(ctx context.Context, packID string,
 			return nil, err
 		}
 	}
+	_, err = tx.ExecContext(ctx, revisePackStatement, packID)
+	if err != nil {
+		return nil, err
+	}
 
 	// commit transaction
 	err = tx.Commit()
@@ -730,6 +1697,27 @@ func (h *deletePackStringHandler) transaction(
 	}
 	rows.Close()
 
+	// delete string display properties
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM pack_strings WHERE pack_id = $1 AND role_id = $2 AND string_id = $3",
+		packID, roleID, stringID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	// the role no longer exists once its last string is deleted
+	_, err = tx.ExecContext(ctx,
+		`
+		DELETE FROM pack_roles WHERE pack_id = $1 AND role_id = $2 AND NOT EXISTS (
+			SELECT 1 FROM pack_resources WHERE pack_id = $1 AND role_id = $2
+		)
+		`,
+		packID, roleID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
 	// recompute the pack hash if anything was deleted
 	if len(resourcesDeleted) > 0 {
 		err = h.updatePackHash(ctx, tx, packID)
@@ -737,6 +1725,10 @@ func (h *deletePackStringHandler) transaction(
 			return nil, err
 		}
 	}
+	_, err = tx.ExecContext(ctx, revisePackStatement, packID)
+	if err != nil {
+		return nil, err
+	}
 
 	// commit transaction
 	err = tx.Commit()
@@ -753,6 +1745,8 @@ type packResourceHandler struct {
 	s3c *s3.Client
 }
 
+// drops a reference to a resource, deleting it once there are none left. it must be
+// called once for every reference dropped, including an upload's own reference.
 func (h *packResourceHandler) pruneResource(ctx context.Context, id string) error {
 	// begin a new transcation
 	tx, err := h.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
@@ -761,22 +1755,61 @@ func (h *packResourceHandler) pruneResource(ctx context.Context, id string) erro
 	}
 	defer tx.Rollback()
 
-	// atttempt delete row from resources tables
-	result, err := tx.ExecContext(ctx, "DELETE FROM resources WHERE resource_id = $1", id)
-	if err != nil {
+	// resources shared by other uploads are kept, the row is locked so that it
+	// cannot be deduplicated against while it is being deleted
+	var refCount int
+	err = tx.QueryRowContext(ctx,
+		"UPDATE resources SET ref_count = ref_count - 1 WHERE resource_id = $1 RETURNING ref_count", id,
+	).Scan(&refCount)
+	if err != nil && err != sql.ErrNoRows {
 		return err
+	} else if err == nil && refCount > 0 {
+		return tx.Commit()
 	}
-	rowsAffected, err := result.RowsAffected()
+
+	// variants of the resource are pruned along with it
+	ids := []string{id}
+	rows, err := tx.QueryContext(ctx,
+		"DELETE FROM resource_variants WHERE resource_id = $1 RETURNING variant_resource_id", id,
+	)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
+	for rows.Next() {
+		var variantID string
+		err := rows.Scan(&variantID)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, variantID)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		// derived data must go first, as it references the resource
+		_, err := tx.ExecContext(ctx, "DELETE FROM resource_waveforms WHERE resource_id = $1", id)
+		if err != nil {
+			return err
+		}
 
-	// if a row was deleted, move it to pruned_resources and commit and start new transaction
-	if rowsAffected == 1 {
-		_, err := tx.ExecContext(ctx, "INSERT INTO pruned_resources (resource_id) VALUES ($1)", id)
+		// atttempt delete row from resources tables
+		result, err := tx.ExecContext(ctx, "DELETE FROM resources WHERE resource_id = $1", id)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
 		if err != nil {
 			return err
 		}
+
+		// if a row was deleted, move it to pruned_resources
+		if rowsAffected == 1 {
+			_, err := tx.ExecContext(ctx, "INSERT INTO pruned_resources (resource_id) VALUES ($1)", id)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	// commit transaction
@@ -785,24 +1818,33 @@ func (h *packResourceHandler) pruneResource(ctx context.Context, id string) erro
 		return err
 	}
 
-	// delete from s3
-	_, err = h.s3c.DeleteObject(ctx, &s3.DeleteObjectInput{
-		Bucket: &h.cfg.S3.MediaBucket,
-		Key:    &id,
-	})
-	if err != nil {
-		return err
-	}
+	for _, id := range ids {
+		// delete from s3
+		_, err = h.s3c.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: &h.cfg.S3.MediaBucket,
+			Key:    &id,
+		})
+		if err != nil {
+			return err
+		}
 
-	// attempt delete row from pruned_resources tables
-	_, err = h.db.ExecContext(ctx, "DELETE FROM pruned_resources WHERE resource_id = $1", id)
-	if err != nil {
-		return err
+		// attempt delete row from pruned_resources tables
+		_, err = h.db.ExecContext(ctx, "DELETE FROM pruned_resources WHERE resource_id = $1", id)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// starts a new draft revision when the published revision of a pack is edited, the
+// published revision is left as it was until the pack is published again
+const revisePackStatement = `
+	UPDATE packs SET revision = revision + 1
+	WHERE pack_id = $1 AND revision = published_revision
+`
+
 func (h *packResourceHandler) updatePackHash(ctx context.Context, tx *sql.Tx, packID string) error {
 	// query postgres for pack roles and strings
 	rows, err := tx.QueryContext(ctx,
@@ -818,9 +1860,8 @@ func (h *packResourceHandler) updatePackHash(ctx context.Context, tx *sql.Tx, pa
 	}
 	defer rows.Close()
 
-	// compute sha256 digest
-	hash := sha256.New()
-	prevRoleID := ""
+	// compute sha256 digest, over the roles that pieces are generated from
+	var roles []game.Role
 	for rows.Next() {
 		var roleID string
 		var stringID string
@@ -828,17 +1869,14 @@ func (h *packResourceHandler) updatePackHash(ctx context.Context, tx *sql.Tx, pa
 		if err != nil {
 			return err
 		}
-		// hash write never returns an error, per https://pkg.go.dev/hash#Hash
-		if roleID != prevRoleID {
-			_, _ = hash.Write([]byte{0})
-			_, _ = hash.Write([]byte(roleID))
+		if len(roles) == 0 || roles[len(roles)-1].ID != roleID {
+			roles = append(roles, game.Role{ID: roleID})
 		}
-		_, _ = hash.Write([]byte{1})
-		_, _ = hash.Write([]byte(stringID))
-		prevRoleID = roleID
+		role := &roles[len(roles)-1]
+		role.Strings = append(role.Strings, stringID)
 	}
 	rows.Close()
-	digest := hash.Sum(nil)
+	digest := game.Hash(roles)
 
 	// update the hash
 	_, err = tx.ExecContext(ctx,
@@ -854,28 +1892,171 @@ func (h *packResourceHandler) updatePackHash(ctx context.Context, tx *sql.Tx, pa
 //  HELPERS
 
 type packString struct {
-	ID    string `json:"id"`
-	Audio int64  `json:"audio,string,omitempty"`
-	Image int64  `json:"image,string,omitempty"`
+	ID       string `json:"id"`
+	Label    string `json:"label,omitempty"`
+	Position int32  `json:"position,omitempty"`
+	Audio    int64  `json:"audio,string,omitempty"`
+	Image    int64  `json:"image,string,omitempty"`
+	Text     int64  `json:"text,string,omitempty"`
+	Video    int64  `json:"video,string,omitempty"`
+	AudioURL string `json:"audioUrl,omitempty"`
+	ImageURL string `json:"imageUrl,omitempty"`
+	TextURL  string `json:"textUrl,omitempty"`
+	VideoURL string `json:"videoUrl,omitempty"`
+
+	AudioMetadata *resourceMetadata `json:"audioMetadata,omitempty"`
+	AudioGain     *float64          `json:"audioGain,omitempty"` // dB to play the audio at the target loudness
+	ImageMetadata *resourceMetadata `json:"imageMetadata,omitempty"`
+	ImageVariants []imageVariant    `json:"imageVariants,omitempty"`
+	ImageBlurHash string            `json:"imageBlurHash,omitempty"` // placeholder to show while the image loads
+	TextMetadata  *resourceMetadata `json:"textMetadata,omitempty"`
+	VideoMetadata *resourceMetadata `json:"videoMetadata,omitempty"`
+}
+
+type imageVariant struct {
+	ID          int64  `json:"id,string"`
+	URL         string `json:"url"`
+	ContentType string `json:"contentType,omitempty"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+}
+
+type resourceMetadata struct {
+	ContentType string   `json:"contentType,omitempty"`
+	Width       int      `json:"width,omitempty"`
+	Height      int      `json:"height,omitempty"`
+	Duration    float64  `json:"duration,omitempty"` // seconds
+	SampleRate  int      `json:"sampleRate,omitempty"`
+	Channels    int      `json:"channels,omitempty"`
+	Size        int64    `json:"size"`
+	SHA256      string   `json:"sha256,omitempty"`
+	Loudness    *float64 `json:"loudness,omitempty"` // LUFS
+	Peak        *float64 `json:"peak,omitempty"`     // dBFS
+}
+
+// a pack's metadata and resources, as returned by the api and as published
+type packDetails struct {
+	packMetadata
+	CoverURL         string     `json:"coverUrl,omitempty"`
+	CoverContentType string     `json:"coverContentType,omitempty"`
+	Hash             string     `json:"hash"`
+	Roles            []packRole `json:"roles"`
+}
+
+// where a pack is in its lifecycle, revisions after the published one are drafts
+type packStatus struct {
+	Status            string `json:"status"`
+	Revision          int    `json:"revision"`
+	PublishedRevision int    `json:"publishedRevision,omitempty"`
 }
 
 type packRole struct {
-	ID      string       `json:"id"`
-	Strings []packString `json:"strings"`
+	ID       string       `json:"id"`
+	Label    string       `json:"label,omitempty"`
+	Position int32        `json:"position,omitempty"`
+	Strings  []packString `json:"strings"`
+}
+
+// active content stripped from an upload is listed in a header, one value per
+// element or attribute, so that the body remains the bare resource id
+func setRemovedContentHeader(header http.Header, removed []string) {
+	for _, r := range removed {
+		header.Add("Removed-Content", r)
+	}
 }
 
 type packSummary struct {
-	ID          int64  `json:"id,string"`
-	Title       string `json:"title"`
+	ID int64 `json:"id,string"`
+	packMetadata
+	packStatus
 	Hash        string `json:"hash"`
 	RoleCount   int    `json:"roleCount"`
 	StringCount int    `json:"stringCount"`
 }
 
+// public url that resources are served from without signing, such as by a cdn
+func mediaURL(cfg *config.S3Config, resourceID int64) string {
+	base := cfg.MediaBaseURL
+	if base == "" {
+		endpoint := cfg.PublicEndpoint
+		if endpoint == "" {
+			endpoint = cfg.Endpoint
+		}
+		base = strings.TrimSuffix(endpoint, "/") + "/" + cfg.MediaBucket
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strconv.FormatInt(resourceID, 10)
+}
+
 var packResourceIDRegex = regexp.MustCompile(`^[a-z0-9_]{1,63}$`)
 
 var errPackNotFoundError = errors.New("pack not found")
 
+var errResourceContentMismatch = errors.New("resource content does not match its content type")
+
+// checks the leading bytes of a resource against its content type, only those
+// bytes are buffered and the returned reader yields the full resource
+func sniffResource(body io.Reader, contentType string) (io.Reader, error) {
+	head := make([]byte, media.SniffLength)
+	n, err := io.ReadFull(body, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	head = head[:n]
+	if !media.Sniff(contentType, head) {
+		return nil, errResourceContentMismatch
+	}
+	return io.MultiReader(bytes.NewReader(head), body), nil
+}
+
+// svgs have their active content removed, which is reported, and photos have
+// their metadata stripped if configured to. Images that are sanitized or can be
+// resized are buffered in memory, so the reader is expected to be limited. Other
+// images are left alone and nil returned.
+func sanitizeImageResource(cfg *config.Config, body io.Reader, contentType string) ([]byte, []string, error) {
+	switch contentType {
+	case "image/svg+xml":
+		svg, err := io.ReadAll(body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read request body: %v", err)
+		}
+		sanitized, removed, err := media.SanitizeSVG(bytes.NewReader(svg))
+		if err != nil {
+			return nil, nil, err
+		} else if len(removed) == 0 {
+			// kept exactly as uploaded
+			return svg, []string{}, nil
+		}
+		return sanitized, removed, nil
+	case "image/jpeg", "image/png", "image/webp", "image/gif":
+		image, err := io.ReadAll(body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read request body: %v", err)
+		}
+		if cfg.Media.StripImageMetadata && contentType != "image/gif" {
+			image, err = media.StripMetadata(contentType, image)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to strip image metadata: %v", err)
+			}
+		}
+		return image, []string{}, nil
+	default:
+		return nil, []string{}, nil
+	}
+}
+
+var errTextResourceEncoding = errors.New("text resource is not valid utf-8")
+
+// text resources are buffered in memory, the reader is expected to be limited
+func readTextResource(r io.Reader) ([]byte, error) {
+	text, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	} else if !utf8.Valid(text) {
+		return nil, errTextResourceEncoding
+	}
+	return text, nil
+}
+
 func isRetryableSerializationFailure(err error) bool {
 	if pqErr, ok := err.(*pq.Error); ok {
 		return pqErr.Code.Name() == "serialization_failure"
@@ -883,28 +2064,75 @@ func isRetryableSerializationFailure(err error) bool {
 	return false
 }
 
-func derivePackResourceClass(contentType string) (string, error) {
-	switch contentType {
+// the http status of an error response from s3, or zero for other errors
+func s3ErrorStatus(err error) int {
+	var responseErr *awshttp.ResponseError
+	if errors.As(err, &responseErr) {
+		return responseErr.HTTPStatusCode()
+	}
+	return 0
+}
+
+// derives the class of a resource from its content type, along with the canonical
+// content type that it is stored and served with
+func derivePackResourceClass(contentType string) (string, string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", "", errors.New("unsupported pack resource content type")
+	}
+	canonicalType, ok := packResourceContentTypes[mediaType]
+	if !ok {
+		return "", "", errors.New("unsupported pack resource content type")
+	}
+	resourceClass := strings.SplitN(canonicalType, "/", 2)[0]
+	if resourceClass == "text" {
+		// text content types, which must be utf-8
+		if charset, ok := params["charset"]; ok && !strings.EqualFold(charset, "utf-8") {
+			return "", "", errors.New("text pack resources must use utf-8")
+		}
+		canonicalType += "; charset=utf-8"
+	}
+	return resourceClass, canonicalType, nil
+}
+
+// maps supported media types, and common aliases of them, to a canonical media type
+var packResourceContentTypes = map[string]string{
 	// image content types
-	case "image/webp":
-		fallthrough
-	case "image/jpeg":
-		fallthrough
-	case "image/png":
-		fallthrough
-	case "image/svg+xml":
-		return "image", nil
+	"image/webp":    "image/webp",
+	"image/jpeg":    "image/jpeg",
+	"image/jpg":     "image/jpeg",
+	"image/pjpeg":   "image/jpeg",
+	"image/png":     "image/png",
+	"image/svg+xml": "image/svg+xml",
+	"image/gif":     "image/gif",
+	"image/avif":    "image/avif",
 	// audio content types
-	case "audio/aac":
-		fallthrough
-	case "audio/mpeg":
-		fallthrough
-	case "audio/wav":
-		fallthrough
-	case "audio/flac":
-		return "audio", nil
-	// unknown content types
-	default:
-		return "", errors.New("unsupported pack resource content type")
-	}
+	"audio/aac":       "audio/aac",
+	"audio/x-aac":     "audio/aac",
+	"audio/aacp":      "audio/aac",
+	"audio/mpeg":      "audio/mpeg",
+	"audio/mp3":       "audio/mpeg",
+	"audio/mpeg3":     "audio/mpeg",
+	"audio/x-mpeg":    "audio/mpeg",
+	"audio/wav":       "audio/wav",
+	"audio/wave":      "audio/wav",
+	"audio/x-wav":     "audio/wav",
+	"audio/vnd.wave":  "audio/wav",
+	"audio/flac":      "audio/flac",
+	"audio/x-flac":    "audio/flac",
+	"audio/ogg":       "audio/ogg",
+	"audio/opus":      "audio/ogg",
+	"audio/x-opus":    "audio/ogg",
+	"audio/vorbis":    "audio/ogg",
+	"application/ogg": "audio/ogg",
+	"audio/mp4":       "audio/mp4",
+	"audio/m4a":       "audio/mp4",
+	"audio/x-m4a":     "audio/mp4",
+	// video content types
+	"video/mp4":  "video/mp4",
+	"video/webm": "video/webm",
+	// text content types
+	"text/plain":      "text/plain",
+	"text/markdown":   "text/markdown",
+	"text/x-markdown": "text/markdown",
 }
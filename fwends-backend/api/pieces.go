@@ -0,0 +1,318 @@
+package api
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"fwends-backend/config"
+	"fwends-backend/game"
+	"fwends-backend/handler"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/text/unicode/norm"
+)
+
+/*
+Example curl commands:
+
+curl -X POST http://localhost:8080/api/pieces/e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855/ -d '{"title":"Opening Night"}'
+curl -X POST http://localhost:8080/api/pieces/e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855/ -d '{"title":"Opening Night","seed":"0123456789abcdef0123456789abcdef"}'
+curl -X GET http://localhost:8080/api/pieces/e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855/
+curl -X GET http://localhost:8080/api/pieces/e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855/0123456789abcdef0123456789abcdef
+curl -X GET 'http://localhost:8080/api/pieces/e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855/0123456789abcdef0123456789abcdef?revision=published'
+curl -X DELETE http://localhost:8080/api/pieces/e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855/0123456789abcdef0123456789abcdef
+*/
+
+// a piece is a titled seed for the packs with a hash, which is only of use while
+// there are packs with the roles and strings the hash was computed from
+type piece struct {
+	Hash  string `json:"hash"`
+	Seed  string `json:"seed"`
+	Title string `json:"title"`
+}
+
+// a pack that a piece can be played with
+type piecePack struct {
+	ID    int64  `json:"id,string"`
+	Title string `json:"title"`
+}
+
+var packHashRegex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// seeds are hex encoded
+var pieceSeedRegex = regexp.MustCompile(fmt.Sprintf(`^[0-9a-f]{%d}$`, game.SeedSize*2))
+
+// POST /api/pieces/:hash/
+//
+// Creates a piece for the packs with a hash, with a random seed unless one is given.
+// There must be a pack with the hash.
+func CreatePiece(cfg *config.Config, db *sql.DB) handler.Handler {
+	return &createPieceHandler{cfg, db}
+}
+
+type createPieceHandler struct {
+	cfg *config.Config
+	db  *sql.DB
+}
+
+func (h *createPieceHandler) Handle(i handler.Input) (int, error) {
+	hash := i.Params.ByName("hash")
+
+	// validation
+	if !packHashRegex.MatchString(hash) {
+		return http.StatusBadRequest, fmt.Errorf("failed to validate pack hash: %v", hash)
+	}
+	var reqbody struct {
+		Title string  `json:"title"`
+		Seed  *string `json:"seed"`
+	}
+	status, err := decodeJSONBody(h.cfg, i.Request, &reqbody)
+	if err != nil {
+		return status, err
+	}
+	title, err := normalizePieceTitle(reqbody.Title)
+	if err != nil {
+		return http.StatusBadRequest, handler.NewPublicError(err)
+	}
+	seed := make([]byte, game.SeedSize)
+	if reqbody.Seed != nil {
+		if !pieceSeedRegex.MatchString(*reqbody.Seed) {
+			return http.StatusBadRequest, handler.NewPublicError(fmt.Errorf(
+				"piece seed must be %d lowercase hex characters", game.SeedSize*2,
+			))
+		}
+		seed, _ = hex.DecodeString(*reqbody.Seed)
+	} else {
+		_, err := rand.Read(seed)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+	hashBytes, _ := hex.DecodeString(hash)
+
+	// pieces can only be made for packs that exist
+	var packExists bool
+	err = h.db.QueryRowContext(i.Request.Context(),
+		"SELECT EXISTS (SELECT 1 FROM packs WHERE hash = $1)", hashBytes,
+	).Scan(&packExists)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	} else if !packExists {
+		return http.StatusNotFound, handler.NewPublicError(errors.New("no pack has this hash"))
+	}
+
+	// insert piece row in postgres
+	result, err := h.db.ExecContext(i.Request.Context(),
+		`
+		INSERT INTO pieces (hash, seed, title) VALUES ($1, $2, $3)
+		ON CONFLICT (hash, seed) DO NOTHING
+		`,
+		hashBytes, seed, title,
+	)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected != 1 {
+		return http.StatusConflict, handler.NewPublicError(errors.New("piece already exists"))
+	}
+
+	// respond to request
+	i.Response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(i.Response).Encode(piece{hash, hex.EncodeToString(seed), title})
+
+	return http.StatusOK, nil
+}
+
+// GET /api/pieces/:hash/
+//
+// Lists the pieces for the packs with a hash.
+func ListPieces(cfg *config.Config, db *sql.DB) handler.Handler {
+	return &listPiecesHandler{cfg, db}
+}
+
+type listPiecesHandler struct {
+	cfg *config.Config
+	db  *sql.DB
+}
+
+func (h *listPiecesHandler) Handle(i handler.Input) (int, error) {
+	hash := i.Params.ByName("hash")
+
+	// validation
+	if !packHashRegex.MatchString(hash) {
+		return http.StatusBadRequest, fmt.Errorf("failed to validate pack hash: %v", hash)
+	}
+	hashBytes, _ := hex.DecodeString(hash)
+
+	rows, err := h.db.QueryContext(i.Request.Context(),
+		"SELECT seed, title FROM pieces WHERE hash = $1 ORDER BY title, seed", hashBytes,
+	)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer rows.Close()
+	pieces := make([]piece, 0)
+	for rows.Next() {
+		var seed []byte
+		p := piece{Hash: hash}
+		err := rows.Scan(&seed, &p.Title)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		p.Seed = hex.EncodeToString(seed)
+		pieces = append(pieces, p)
+	}
+	rows.Close()
+
+	// respond to request
+	i.Response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(i.Response).Encode(pieces)
+
+	return http.StatusOK, nil
+}
+
+// GET /api/pieces/:hash/:seed
+//
+// Gets a piece, with the packs it can be played with. Unauthenticated users, and those
+// asking for the published revisions, are only given packs published with the hash.
+func GetPiece(cfg *config.Config, db *sql.DB, rdb *redis.Client) handler.Handler {
+	return &getPieceHandler{cfg, db, rdb}
+}
+
+type getPieceHandler struct {
+	cfg *config.Config
+	db  *sql.DB
+	rdb *redis.Client
+}
+
+func (h *getPieceHandler) Handle(i handler.Input) (int, error) {
+	hash := i.Params.ByName("hash")
+	seed := i.Params.ByName("seed")
+
+	// validation
+	if !packHashRegex.MatchString(hash) {
+		return http.StatusBadRequest, fmt.Errorf("failed to validate pack hash: %v", hash)
+	}
+	if !pieceSeedRegex.MatchString(seed) {
+		return http.StatusBadRequest, fmt.Errorf("failed to validate piece seed: %v", seed)
+	}
+	hashBytes, _ := hex.DecodeString(hash)
+	seedBytes, _ := hex.DecodeString(seed)
+
+	var resbody struct {
+		piece
+		Packs []piecePack `json:"packs"`
+	}
+	resbody.Hash = hash
+	resbody.Seed = seed
+	err := h.db.QueryRowContext(i.Request.Context(),
+		"SELECT title FROM pieces WHERE hash = $1 AND seed = $2", hashBytes, seedBytes,
+	).Scan(&resbody.Title)
+	if err == sql.ErrNoRows {
+		return http.StatusNotFound, nil
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	// published packs are compatible if they were published with the hash, as that
+	// is the revision unauthenticated users play
+	authenticated, err := isAuthenticated(i.Request.Context(), h.cfg, h.rdb, i.Request)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	var rows *sql.Rows
+	if authenticated && i.Request.URL.Query().Get("revision") != "published" {
+		rows, err = h.db.QueryContext(i.Request.Context(),
+			"SELECT pack_id, title FROM packs WHERE hash = $1 ORDER BY pack_id", hashBytes,
+		)
+	} else {
+		rows, err = h.db.QueryContext(i.Request.Context(),
+			`
+			SELECT packs.pack_id, published_packs.pack->>'title'
+			FROM packs
+				INNER JOIN published_packs ON published_packs.pack_id = packs.pack_id
+			WHERE packs.status = 'published' AND published_packs.pack->>'hash' = $1
+			ORDER BY packs.pack_id
+			`,
+			hash,
+		)
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer rows.Close()
+	resbody.Packs = make([]piecePack, 0)
+	for rows.Next() {
+		var pack piecePack
+		err := rows.Scan(&pack.ID, &pack.Title)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		resbody.Packs = append(resbody.Packs, pack)
+	}
+	rows.Close()
+
+	// respond to request
+	i.Response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(i.Response).Encode(resbody)
+
+	return http.StatusOK, nil
+}
+
+// DELETE /api/pieces/:hash/:seed
+//
+// Deletes a piece.
+func DeletePiece(cfg *config.Config, db *sql.DB) handler.Handler {
+	return &deletePieceHandler{cfg, db}
+}
+
+type deletePieceHandler struct {
+	cfg *config.Config
+	db  *sql.DB
+}
+
+func (h *deletePieceHandler) Handle(i handler.Input) (int, error) {
+	hash := i.Params.ByName("hash")
+	seed := i.Params.ByName("seed")
+
+	// validation
+	if !packHashRegex.MatchString(hash) {
+		return http.StatusBadRequest, fmt.Errorf("failed to validate pack hash: %v", hash)
+	}
+	if !pieceSeedRegex.MatchString(seed) {
+		return http.StatusBadRequest, fmt.Errorf("failed to validate piece seed: %v", seed)
+	}
+	hashBytes, _ := hex.DecodeString(hash)
+	seedBytes, _ := hex.DecodeString(seed)
+
+	_, err := h.db.ExecContext(i.Request.Context(),
+		"DELETE FROM pieces WHERE hash = $1 AND seed = $2", hashBytes, seedBytes,
+	)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusOK, nil
+}
+
+// HELPERS
+
+const maxPieceTitleLength = 255
+
+func normalizePieceTitle(title string) (string, error) {
+	title = norm.NFC.String(strings.TrimSpace(title))
+	if title == "" {
+		return "", errors.New("piece title is required")
+	} else if utf8.RuneCountInString(title) > maxPieceTitleLength {
+		return "", fmt.Errorf("piece title exceeds %d characters", maxPieceTitleLength)
+	}
+	return title, nil
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"fwends-backend/config"
+	"fwends-backend/handler"
+	"fwends-backend/util"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+// decodes a json request body into v, failing if the body exceeds the configured limit
+func decodeJSONBody(cfg *config.Config, r *http.Request, v interface{}) (int, error) {
+	body := util.NewLimitedReader(r.Body, cfg.Limits.MaxJSONBodySize)
+	decoder := json.NewDecoder(body)
+	err := decoder.Decode(v)
+	if body.Exceeded() {
+		return http.StatusRequestEntityTooLarge, handler.NewPublicError(fmt.Errorf(
+			"request body exceeds %d bytes", cfg.Limits.MaxJSONBodySize,
+		))
+	} else if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("failed to decode request body: %v", err)
+	}
+	return http.StatusOK, nil
+}
+
+// the maximum size in bytes of a resource of the given class
+func packResourceSizeLimit(cfg *config.Config, resourceClass string) int64 {
+	switch resourceClass {
+	case "image":
+		return cfg.Limits.MaxImageSize
+	case "audio":
+		return cfg.Limits.MaxAudioSize
+	case "video":
+		return cfg.Limits.MaxVideoSize
+	case "text":
+		return cfg.Limits.MaxTextSize
+	default:
+		return 0
+	}
+}
+
+// hashes that request bodies can be verified with, by their http digest algorithm name
+var requestDigestAlgorithms = map[string]func() hash.Hash{
+	"md5":     md5.New,
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// parses the digests a client sent of a request body, in either a Content-MD5,
+// Digest or Repr-Digest header, skipping algorithms that are not supported
+func parseRequestDigests(header http.Header) ([]util.Digest, error) {
+	var digests []util.Digest
+	addDigest := func(name string, algorithm string, encoded string) error {
+		newHash, ok := requestDigestAlgorithms[strings.ToLower(algorithm)]
+		if !ok {
+			return nil
+		}
+		expected, err := base64.StdEncoding.DecodeString(encoded)
+		h := newHash()
+		if err != nil || len(expected) != h.Size() {
+			return handler.NewPublicError(fmt.Errorf("malformed %v header", name))
+		}
+		digests = append(digests, util.Digest{Hash: h, Expected: expected})
+		return nil
+	}
+
+	if value := header.Get("Content-MD5"); value != "" {
+		err := addDigest("Content-MD5", "md5", strings.TrimSpace(value))
+		if err != nil {
+			return nil, err
+		}
+	}
+	// see https://www.rfc-editor.org/rfc/rfc3230
+	for _, item := range splitHeaderList(header.Values("Digest")) {
+		algorithm, value, _ := cutString(item, "=")
+		err := addDigest("Digest", algorithm, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// see https://www.rfc-editor.org/rfc/rfc9530, values are byte sequences wrapped in colons
+	for _, item := range splitHeaderList(header.Values("Repr-Digest")) {
+		algorithm, value, _ := cutString(item, "=")
+		if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+			return nil, handler.NewPublicError(errors.New("malformed Repr-Digest header"))
+		}
+		err := addDigest("Repr-Digest", algorithm, value[1:len(value)-1])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return digests, nil
+}
+
+// splits comma separated header values into trimmed, non-empty items
+func splitHeaderList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// like strings.Cut, which needs a newer go
+func cutString(s string, sep string) (string, string, bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"fwends-backend/config"
+	"fwends-backend/handler"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+/*
+Example curl commands:
+
+curl -X GET http://localhost:8080/api/resources/6882582496895041537/waveform
+curl -X GET http://localhost:8080/api/resources/6882582496895041537/waveform?revision=published
+*/
+
+// GET /api/resources/:resource_id/waveform
+//
+// Gets the peaks of an audio resource's waveform, from zero to one. Unauthenticated
+// users, and those asking for published resources, only get the waveforms of
+// resources in the published revision of a pack.
+func GetResourceWaveform(cfg *config.Config, db *sql.DB, rdb *redis.Client) handler.Handler {
+	return &getResourceWaveformHandler{cfg, db, rdb}
+}
+
+type getResourceWaveformHandler struct {
+	cfg *config.Config
+	db  *sql.DB
+	rdb *redis.Client
+}
+
+func (h *getResourceWaveformHandler) Handle(i handler.Input) (int, error) {
+	resourceID := i.Params.ByName("resource_id")
+
+	// validation
+	if _, err := strconv.ParseInt(resourceID, 10, 64); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("failed to validate resource id: %v", resourceID)
+	}
+
+	authenticated, err := isAuthenticated(i.Request.Context(), h.cfg, h.rdb, i.Request)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	published := !authenticated || i.Request.URL.Query().Get("revision") == "published"
+
+	// only audio that could be decoded has a waveform
+	var quantized []byte
+	err = h.db.QueryRowContext(i.Request.Context(),
+		`
+		SELECT peaks FROM resource_waveforms
+		WHERE resource_id = $1 AND (NOT $2 OR EXISTS (
+			SELECT 1
+			FROM published_packs
+				INNER JOIN packs ON packs.pack_id = published_packs.pack_id
+			WHERE
+				published_packs.resource_ids @> ARRAY[$1::bigint] AND
+				packs.status IN ('published', 'archived')
+		))
+		`,
+		resourceID, published,
+	).Scan(&quantized)
+	if err == sql.ErrNoRows {
+		return http.StatusNotFound, nil
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	var resbody struct {
+		Peaks []float64 `json:"peaks"`
+	}
+	resbody.Peaks = make([]float64, len(quantized))
+	for i, peak := range quantized {
+		resbody.Peaks[i] = math.Round(float64(peak)/255*1000) / 1000
+	}
+
+	// respond to request
+	i.Response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(i.Response).Encode(resbody)
+
+	return http.StatusOK, nil
+}
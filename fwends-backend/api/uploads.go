@@ -0,0 +1,749 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"fwends-backend/config"
+	"fwends-backend/handler"
+	"fwends-backend/util"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+/*
+Example curl commands:
+
+curl -X POST http://localhost:8080/api/uploads/ -d '{"pack":"6882582496895041536","role":"bird","string":"eagle","contentType":"audio/mpeg","size":12000000}'
+curl -X POST http://localhost:8080/api/uploads/ -d '{"pack":"6882582496895041536","role":"bird","string":"eagle","contentType":"audio/mpeg","size":12000000,"presigned":true}'
+curl -X PATCH http://localhost:8080/api/uploads/6882582496895041537 -H 'Upload-Offset: 0' --data-binary @./chunk-0
+curl -X GET http://localhost:8080/api/uploads/6882582496895041537
+curl -X POST http://localhost:8080/api/uploads/6882582496895041537/finalize
+curl -X DELETE http://localhost:8080/api/uploads/6882582496895041537
+*/
+
+// s3 requires parts other than the last to be at least 5 MiB, so chunks must be too
+const uploadChunkMinSize = 5 * 1024 * 1024
+
+// how long a chunk or finalize request has the upload to itself, in-case the pod
+// handling it goes away without unlocking it
+const uploadSessionLockTTL = 15 * time.Minute
+
+// how often abandoned upload sessions are looked for
+const uploadSessionExpiryInterval = time.Minute
+
+// POST /api/uploads/
+//
+// Starts a resumable upload of an audio or video pack resource, which is sent in
+// chunks and then finalized. Presigned uploads are instead sent straight to s3, by
+// a PUT of exactly the given size to the returned url with the returned headers,
+// before being finalized. The url expires well before the session, which expires if
+// left untouched.
+func CreateUpload(
+	cfg *config.Config, db *sql.DB, s3c *s3.Client, s3p *s3.PresignClient, idgen *util.SnowflakeGenerator,
+) handler.Handler {
+	return &createUploadHandler{s3p, idgen, uploadSessionHandler{packResourceHandler{cfg, db, s3c}}}
+}
+
+type createUploadHandler struct {
+	s3p   *s3.PresignClient
+	idgen *util.SnowflakeGenerator
+	uploadSessionHandler
+}
+
+type createUploadRequest struct {
+	Pack        string `json:"pack"`
+	Role        string `json:"role"`
+	String      string `json:"string"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	Presigned   bool   `json:"presigned"`
+}
+
+type presignedUpload struct {
+	uploadProgress
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+}
+
+func (h *createUploadHandler) Handle(i handler.Input) (int, error) {
+	var reqbody createUploadRequest
+	status, err := decodeJSONBody(h.cfg, i.Request, &reqbody)
+	if err != nil {
+		return status, err
+	}
+
+	// validation
+	if _, err := strconv.ParseInt(reqbody.Pack, 10, 64); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("failed to validate pack id: %v", reqbody.Pack)
+	}
+	if !packResourceIDRegex.MatchString(reqbody.Role) {
+		return http.StatusBadRequest, fmt.Errorf("failed to validate role id: %v", reqbody.Role)
+	}
+	if !packResourceIDRegex.MatchString(reqbody.String) {
+		return http.StatusBadRequest, fmt.Errorf("failed to validate string id: %v", reqbody.String)
+	}
+	resourceClass, contentType, err := derivePackResourceClass(reqbody.ContentType)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	// images and text are small enough to upload in one go, and are buffered anyway
+	if resourceClass != "audio" && resourceClass != "video" {
+		return http.StatusBadRequest, handler.NewPublicError(
+			errors.New("only audio and video pack resources can be uploaded in chunks"),
+		)
+	}
+	if reqbody.Size <= 0 {
+		return http.StatusBadRequest, handler.NewPublicError(errors.New("upload size must be positive"))
+	}
+	sizeLimit := packResourceSizeLimit(h.cfg, resourceClass)
+	if reqbody.Size > sizeLimit {
+		return http.StatusRequestEntityTooLarge, handler.NewPublicError(
+			fmt.Errorf("%v pack resource exceeds %d bytes", resourceClass, sizeLimit),
+		)
+	}
+
+	// check whether pack exists, it is checked again when the upload is finalized
+	packExists, err := h.packExists(i.Request.Context(), reqbody.Pack)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !packExists {
+		return http.StatusNotFound, nil
+	}
+
+	// insert row to mark possble existance of resource in s3, the session holds its
+	// first reference until it is finalized, or discarded
+	resourceID := strconv.FormatInt(h.idgen.GenID(), 10)
+	_, err = h.db.ExecContext(i.Request.Context(),
+		"INSERT INTO resources (resource_id, content_type, ref_count) VALUES ($1, $2, 1)",
+		resourceID, contentType,
+	)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	// chunks are uploaded straight to s3 as parts of a multipart upload, presigned
+	// uploads are put by the client in one go
+	multipartUploadID := sql.NullString{}
+	if !reqbody.Presigned {
+		upload, err := h.s3c.CreateMultipartUpload(i.Request.Context(), &s3.CreateMultipartUploadInput{
+			Bucket:      &h.cfg.S3.MediaBucket,
+			Key:         &resourceID,
+			ContentType: &contentType,
+		})
+		if err != nil {
+			go h.pruneResource(context.Background(), resourceID)
+			return http.StatusInternalServerError, err
+		}
+		multipartUploadID = sql.NullString{String: *upload.UploadId, Valid: true}
+	}
+	session, err := scanUploadSession(h.db.QueryRowContext(i.Request.Context(),
+		`
+		INSERT INTO upload_sessions (
+			upload_id, resource_id, pack_id, role_id, string_id, resource_class,
+			content_type, size, presigned, multipart_upload_id, expires_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, now() + $11 * interval '1 millisecond')
+		RETURNING `+uploadSessionColumns,
+		h.idgen.GenID(), resourceID, reqbody.Pack, reqbody.Role, reqbody.String, resourceClass,
+		contentType, reqbody.Size, reqbody.Presigned, multipartUploadID,
+		h.cfg.Uploads.UploadSessionTTL.Milliseconds(),
+	))
+	if err != nil {
+		go h.discardUploadSession(context.Background(), resourceID, multipartUploadID)
+		return http.StatusInternalServerError, err
+	}
+
+	i.Response.Header().Set("Content-Type", "application/json")
+	if !session.presigned {
+		json.NewEncoder(i.Response).Encode(session.progress())
+		return http.StatusOK, nil
+	}
+
+	// the size and content type are signed, so s3 rejects anything else. the url
+	// only puts to a staging key that is copied when finalized, and it expires well
+	// before the session, so it cannot be used to replace the resource later.
+	expires := h.cfg.Uploads.UploadPresignTTL
+	if untilExpiry := time.Until(session.expiresAt); untilExpiry < expires {
+		expires = untilExpiry
+	}
+	presigned, err := h.s3p.PresignPutObject(i.Request.Context(), &s3.PutObjectInput{
+		Bucket:        &h.cfg.S3.MediaBucket,
+		Key:           &resourceID,
+		ContentLength: session.size,
+		ContentType:   &session.contentType,
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	headers := map[string]string{}
+	for name := range presigned.SignedHeader {
+		if name != "Host" {
+			headers[name] = presigned.SignedHeader.Get(name)
+		}
+	}
+	json.NewEncoder(i.Response).Encode(presignedUpload{session.progress(), presigned.URL, headers})
+	return http.StatusOK, nil
+}
+
+// GET /api/uploads/:upload_id
+//
+// Gets the progress of a resumable upload, so that it can be resumed from its offset.
+func GetUpload(cfg *config.Config, db *sql.DB) handler.Handler {
+	return &getUploadHandler{cfg, db}
+}
+
+type getUploadHandler struct {
+	cfg *config.Config
+	db  *sql.DB
+}
+
+func (h *getUploadHandler) Handle(i handler.Input) (int, error) {
+	uploadID := i.Params.ByName("upload_id")
+	if _, err := strconv.ParseInt(uploadID, 10, 64); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("failed to validate upload id: %v", uploadID)
+	}
+
+	rows, err := h.db.QueryContext(i.Request.Context(),
+		"SELECT "+uploadSessionColumns+" FROM upload_sessions WHERE upload_id = $1", uploadID,
+	)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return http.StatusNotFound, nil
+	}
+	session, err := scanUploadSession(rows)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	i.Response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(i.Response).Encode(session.progress())
+	return http.StatusOK, nil
+}
+
+// PATCH /api/uploads/:upload_id
+//
+// Appends a chunk to a resumable upload, at the offset given in an Upload-Offset
+// header which must match the progress of the upload. Chunks other than the last
+// must be at least 5 MiB. The chunk is verified against a Content-MD5, Digest or
+// Repr-Digest header if one is sent, and is only kept if received in full.
+func UploadChunk(cfg *config.Config, db *sql.DB, s3c *s3.Client) handler.Handler {
+	return &uploadChunkHandler{uploadSessionHandler{packResourceHandler{cfg, db, s3c}}}
+}
+
+type uploadChunkHandler struct {
+	uploadSessionHandler
+}
+
+func (h *uploadChunkHandler) Handle(i handler.Input) (int, error) {
+	uploadID := i.Params.ByName("upload_id")
+	if _, err := strconv.ParseInt(uploadID, 10, 64); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("failed to validate upload id: %v", uploadID)
+	}
+	offset, err := strconv.ParseInt(i.Request.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return http.StatusBadRequest, handler.NewPublicError(errors.New("missing or malformed Upload-Offset header"))
+	}
+	// the length must be known upfront for the part to be uploaded to s3
+	chunkSize := i.Request.ContentLength
+	if chunkSize < 0 {
+		return http.StatusLengthRequired, nil
+	}
+	digests, err := parseRequestDigests(i.Request.Header)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	// only one chunk can be appended at a time
+	session, err := h.lockUploadSession(i.Request.Context(), uploadID)
+	if err == errUploadNotFound {
+		return http.StatusNotFound, err
+	} else if err == errUploadLocked {
+		return http.StatusConflict, err
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer h.unlockUploadSession(context.Background(), uploadID)
+	if session.presigned {
+		return http.StatusBadRequest, handler.NewPublicError(
+			errors.New("presigned uploads are sent straight to s3, not in chunks"),
+		)
+	}
+
+	// the client must resume from where the upload is up to
+	if offset != session.received {
+		return http.StatusConflict, handler.NewPublicError(
+			fmt.Errorf("upload offset is %d, not %d", session.received, offset),
+		)
+	}
+	if chunkSize == 0 || offset+chunkSize > session.size {
+		return http.StatusBadRequest, handler.NewPublicError(
+			fmt.Errorf("chunk does not fit the %d remaining bytes of the upload", session.size-offset),
+		)
+	}
+	if chunkSize < uploadChunkMinSize && offset+chunkSize < session.size {
+		return http.StatusBadRequest, handler.NewPublicError(
+			fmt.Errorf("chunks other than the last must be at least %d bytes", uploadChunkMinSize),
+		)
+	}
+
+	// upload the chunk as the next part, a chunk that is cut short leaves no part
+	verifiedBody := util.NewVerifyingReader(i.Request.Body, chunkSize, digests)
+	errDigestMismatch := handler.NewPublicError(errors.New("upload chunk does not match its digest"))
+	partNumber := int32(len(session.partETags) + 1)
+	part, err := h.s3c.UploadPart(i.Request.Context(), &s3.UploadPartInput{
+		Bucket:        &h.cfg.S3.MediaBucket,
+		Key:           &session.resourceID,
+		UploadId:      &session.multipartUploadID.String,
+		PartNumber:    partNumber,
+		Body:          verifiedBody,
+		ContentLength: chunkSize,
+	}, s3.WithAPIOptions(
+		v4.SwapComputePayloadSHA256ForUnsignedPayloadMiddleware,
+	))
+	if verifiedBody.Mismatched() {
+		return http.StatusBadRequest, errDigestMismatch
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if verifiedBody.Verify() != nil {
+		return http.StatusBadRequest, errDigestMismatch
+	}
+
+	// record the part, which advances the offset
+	session.received += chunkSize
+	session.partETags = append(session.partETags, *part.ETag)
+	_, err = h.db.ExecContext(i.Request.Context(),
+		"UPDATE upload_sessions SET received = $2, part_etags = $3 WHERE upload_id = $1",
+		uploadID, session.received, pq.Array(session.partETags),
+	)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	i.Response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(i.Response).Encode(session.progress())
+	return http.StatusOK, nil
+}
+
+// POST /api/uploads/:upload_id/finalize
+//
+// Completes a resumable upload once all of its chunks have been received, or a
+// presigned upload once it has been put to s3, and adds or replaces the pack
+// resource with it. Presigned uploads are copied to a new resource, so the id of
+// the resource differs from the key they were put to. Finalizing can be retried if
+// it fails.
+func FinalizeUpload(cfg *config.Config, db *sql.DB, s3c *s3.Client, idgen *util.SnowflakeGenerator) handler.Handler {
+	return &finalizeUploadHandler{idgen, uploadSessionHandler{packResourceHandler{cfg, db, s3c}}}
+}
+
+type finalizeUploadHandler struct {
+	idgen *util.SnowflakeGenerator
+	uploadSessionHandler
+}
+
+func (h *finalizeUploadHandler) Handle(i handler.Input) (int, error) {
+	uploadID := i.Params.ByName("upload_id")
+	if _, err := strconv.ParseInt(uploadID, 10, 64); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("failed to validate upload id: %v", uploadID)
+	}
+
+	session, err := h.lockUploadSession(i.Request.Context(), uploadID)
+	if err == errUploadNotFound {
+		return http.StatusNotFound, err
+	} else if err == errUploadLocked {
+		return http.StatusConflict, err
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer h.unlockUploadSession(context.Background(), uploadID)
+
+	// presigned uploads are checked for in s3, which is what they are received by
+	if session.presigned && session.received != session.size {
+		object, err := h.s3c.HeadObject(i.Request.Context(), &s3.HeadObjectInput{
+			Bucket: &h.cfg.S3.MediaBucket,
+			Key:    &session.resourceID,
+		})
+		if s3ErrorStatus(err) == http.StatusNotFound {
+			return http.StatusConflict, handler.NewPublicError(errors.New("upload has not been received"))
+		} else if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if object.ContentLength != session.size || object.ContentType == nil || *object.ContentType != session.contentType {
+			return http.StatusBadRequest, handler.NewPublicError(
+				errors.New("upload does not match the size and content type it was presigned with"),
+			)
+		}
+		session.received = session.size
+		_, err = h.db.ExecContext(i.Request.Context(),
+			"UPDATE upload_sessions SET received = $2 WHERE upload_id = $1", uploadID, session.received,
+		)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+	if session.received != session.size {
+		return http.StatusConflict, handler.NewPublicError(
+			fmt.Errorf("upload is incomplete, %d of %d bytes received", session.received, session.size),
+		)
+	}
+
+	// complete the multipart upload, which is only done once if finalizing is retried
+	if session.multipartUploadID.Valid {
+		parts := make([]types.CompletedPart, len(session.partETags))
+		for i := range session.partETags {
+			parts[i] = types.CompletedPart{ETag: &session.partETags[i], PartNumber: int32(i + 1)}
+		}
+		_, err = h.s3c.CompleteMultipartUpload(i.Request.Context(), &s3.CompleteMultipartUploadInput{
+			Bucket:          &h.cfg.S3.MediaBucket,
+			Key:             &session.resourceID,
+			UploadId:        &session.multipartUploadID.String,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+		})
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		_, err = h.db.ExecContext(i.Request.Context(),
+			"UPDATE upload_sessions SET multipart_upload_id = NULL WHERE upload_id = $1", uploadID,
+		)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	// take a reference to a resource for this request, the session keeps its own
+	// until it is ended along with linking, so that finalizing can be retried.
+	// presigned uploads are copied to a new resource, as the client could put to
+	// the staging key again while the url lasts.
+	resourceID, err := h.takeUploadResource(i.Request.Context(), session)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	// defer prune the resource, in-case the transaction does not complete
+	transactionCommited := false
+	defer func() {
+		if !transactionCommited {
+			go h.pruneResource(context.Background(), resourceID)
+		}
+	}()
+
+	// the chunks could not be probed as they arrived, so the whole resource is read
+	// back from s3 to check its content type and read its metadata
+	object, err := h.s3c.GetObject(i.Request.Context(), &s3.GetObjectInput{
+		Bucket: &h.cfg.S3.MediaBucket,
+		Key:    &resourceID,
+	})
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer object.Body.Close()
+	body, err := sniffResource(object.Body, session.contentType)
+	if err == errResourceContentMismatch {
+		return http.StatusUnsupportedMediaType, err
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	err = h.analyzeResource(i.Request.Context(), resourceID, body, session.contentType,
+		func(body io.Reader) error {
+			_, err := io.Copy(io.Discard, body)
+			return err
+		},
+	)
+	if errors.Is(err, errResourceMetadata) {
+		return http.StatusBadRequest, err
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	// reuse an identical resource if there is one, taking over its waveform and such
+	resourceID, err = h.dedupeResource(i.Request.Context(), resourceID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	// link the resource to the pack string, replacing any previous one, and end the
+	// session in the same transaction
+	err = h.linkPackResource(i.Request.Context(),
+		session.packID, session.roleID, session.stringID, session.resourceClass, resourceID, uploadID,
+	)
+	if err == errPackNotFoundError || err == errUploadNotFound {
+		return http.StatusNotFound, err
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	transactionCommited = true
+
+	// the session's reference is dropped now that it is ended
+	go h.pruneResource(context.Background(), session.resourceID)
+
+	i.Response.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(i.Response).Encode(resourceID)
+	return http.StatusOK, nil
+}
+
+// takes a reference to the resource of a session that is being finalized, which is
+// a new copy of it if it was presigned
+func (h *finalizeUploadHandler) takeUploadResource(ctx context.Context, session uploadSession) (string, error) {
+	if !session.presigned {
+		_, err := h.db.ExecContext(ctx,
+			"UPDATE resources SET ref_count = ref_count + 1 WHERE resource_id = $1", session.resourceID,
+		)
+		return session.resourceID, err
+	}
+
+	// insert row to mark possble existance of resource in s3, this request holds
+	// its first reference until it is linked to a pack, or pruned
+	resourceID := strconv.FormatInt(h.idgen.GenID(), 10)
+	_, err := h.db.ExecContext(ctx,
+		"INSERT INTO resources (resource_id, content_type, ref_count) VALUES ($1, $2, 1)",
+		resourceID, session.contentType,
+	)
+	if err != nil {
+		return "", err
+	}
+	_, err = h.s3c.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     &h.cfg.S3.MediaBucket,
+		Key:        &resourceID,
+		CopySource: aws.String(url.PathEscape(h.cfg.S3.MediaBucket) + "/" + session.resourceID),
+	})
+	if err != nil {
+		go h.pruneResource(context.Background(), resourceID)
+		return "", err
+	}
+	return resourceID, nil
+}
+
+// DELETE /api/uploads/:upload_id
+//
+// Abandons a resumable upload, discarding the chunks received so far.
+func DeleteUpload(cfg *config.Config, db *sql.DB, s3c *s3.Client) handler.Handler {
+	return &deleteUploadHandler{uploadSessionHandler{packResourceHandler{cfg, db, s3c}}}
+}
+
+type deleteUploadHandler struct {
+	uploadSessionHandler
+}
+
+func (h *deleteUploadHandler) Handle(i handler.Input) (int, error) {
+	uploadID := i.Params.ByName("upload_id")
+	if _, err := strconv.ParseInt(uploadID, 10, 64); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("failed to validate upload id: %v", uploadID)
+	}
+
+	// sessions busy with a chunk or being finalized are left alone
+	var resourceID string
+	var multipartUploadID sql.NullString
+	err := h.db.QueryRowContext(i.Request.Context(),
+		`
+		DELETE FROM upload_sessions
+		WHERE upload_id = $1 AND (locked_until IS NULL OR locked_until < now())
+		RETURNING resource_id, multipart_upload_id
+		`,
+		uploadID,
+	).Scan(&resourceID, &multipartUploadID)
+	if err == sql.ErrNoRows {
+		exists, err := h.uploadSessionExists(i.Request.Context(), uploadID)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		} else if exists {
+			return http.StatusConflict, errUploadLocked
+		}
+		return http.StatusNotFound, nil
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	go h.discardUploadSession(context.Background(), resourceID, multipartUploadID)
+	return http.StatusOK, nil
+}
+
+// ExpireUploadSessions periodically discards upload sessions that have been left
+// untouched for longer than the configured ttl, until the context is done. It is
+// safe to run on every pod, as each expired session is only claimed by one of them.
+func ExpireUploadSessions(ctx context.Context, cfg *config.Config, db *sql.DB, s3c *s3.Client, logger *zap.Logger) {
+	h := &uploadSessionHandler{packResourceHandler{cfg, db, s3c}}
+	ticker := time.NewTicker(uploadSessionExpiryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		expired, err := h.claimExpiredUploadSessions(ctx)
+		if err != nil {
+			logger.With(zap.Error(err)).Warn("failed to expire upload sessions")
+			continue
+		}
+		for _, session := range expired {
+			err := h.discardUploadSession(ctx, session.resourceID, session.multipartUploadID)
+			if err != nil {
+				logger.With(zap.Error(err), zap.String("resource_id", session.resourceID)).
+					Warn("failed to discard expired upload session")
+			}
+		}
+		if len(expired) > 0 {
+			logger.With(zap.Int("count", len(expired))).Info("expired upload sessions")
+		}
+	}
+}
+
+type uploadSessionHandler struct {
+	packResourceHandler
+}
+
+var errUploadNotFound = errors.New("upload not found")
+
+var errUploadLocked = handler.NewPublicError(errors.New("upload is busy with another request"))
+
+// columns of an upload session, in the order scanUploadSession expects them
+const uploadSessionColumns = `
+	upload_id, resource_id, pack_id, role_id, string_id, resource_class, content_type,
+	size, received, presigned, multipart_upload_id, part_etags, expires_at
+`
+
+type uploadSession struct {
+	uploadID          string
+	resourceID        string
+	packID            string
+	roleID            string
+	stringID          string
+	resourceClass     string
+	contentType       string
+	size              int64
+	received          int64
+	presigned         bool
+	multipartUploadID sql.NullString // null once the multipart upload is completed
+	partETags         []string
+	expiresAt         time.Time
+}
+
+func scanUploadSession(row interface{ Scan(...interface{}) error }) (uploadSession, error) {
+	var s uploadSession
+	err := row.Scan(
+		&s.uploadID, &s.resourceID, &s.packID, &s.roleID, &s.stringID, &s.resourceClass, &s.contentType,
+		&s.size, &s.received, &s.presigned, &s.multipartUploadID, pq.Array(&s.partETags), &s.expiresAt,
+	)
+	return s, err
+}
+
+type uploadProgress struct {
+	ID      string    `json:"id"`
+	Offset  int64     `json:"offset"`
+	Size    int64     `json:"size"`
+	Expires time.Time `json:"expires"`
+}
+
+func (s uploadSession) progress() uploadProgress {
+	return uploadProgress{s.uploadID, s.received, s.size, s.expiresAt}
+}
+
+func (h *uploadSessionHandler) uploadSessionExists(ctx context.Context, uploadID string) (bool, error) {
+	rows, err := h.db.QueryContext(ctx,
+		"SELECT 1 FROM upload_sessions WHERE upload_id = $1", uploadID,
+	)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	return rows.Next(), nil
+}
+
+// takes an upload session for a request, which also keeps it from expiring. it must
+// be unlocked once the request is done with it.
+func (h *uploadSessionHandler) lockUploadSession(ctx context.Context, uploadID string) (uploadSession, error) {
+	session, err := scanUploadSession(h.db.QueryRowContext(ctx,
+		`
+		UPDATE upload_sessions SET
+			locked_until = now() + $2 * interval '1 millisecond',
+			expires_at = now() + $3 * interval '1 millisecond'
+		WHERE upload_id = $1 AND (locked_until IS NULL OR locked_until < now())
+		RETURNING `+uploadSessionColumns,
+		uploadID, uploadSessionLockTTL.Milliseconds(), h.cfg.Uploads.UploadSessionTTL.Milliseconds(),
+	))
+	if err == sql.ErrNoRows {
+		exists, err := h.uploadSessionExists(ctx, uploadID)
+		if err != nil {
+			return uploadSession{}, err
+		} else if exists {
+			return uploadSession{}, errUploadLocked
+		}
+		return uploadSession{}, errUploadNotFound
+	}
+	return session, err
+}
+
+func (h *uploadSessionHandler) unlockUploadSession(ctx context.Context, uploadID string) error {
+	_, err := h.db.ExecContext(ctx,
+		"UPDATE upload_sessions SET locked_until = NULL WHERE upload_id = $1", uploadID,
+	)
+	return err
+}
+
+type expiredUploadSession struct {
+	resourceID        string
+	multipartUploadID sql.NullString
+}
+
+// ends expired sessions that are not locked, which are then to be discarded
+func (h *uploadSessionHandler) claimExpiredUploadSessions(ctx context.Context) ([]expiredUploadSession, error) {
+	rows, err := h.db.QueryContext(ctx,
+		`
+		DELETE FROM upload_sessions
+		WHERE expires_at < now() AND (locked_until IS NULL OR locked_until < now())
+		RETURNING resource_id, multipart_upload_id
+		`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var expired []expiredUploadSession
+	for rows.Next() {
+		var session expiredUploadSession
+		err := rows.Scan(&session.resourceID, &session.multipartUploadID)
+		if err != nil {
+			return nil, err
+		}
+		expired = append(expired, session)
+	}
+	return expired, rows.Err()
+}
+
+// aborts the multipart upload of an ended session, if it was not completed, so
+// that s3 discards its parts, and drops the session's reference to its resource
+func (h *uploadSessionHandler) discardUploadSession(
+	ctx context.Context, resourceID string, multipartUploadID sql.NullString,
+) error {
+	var abortErr error
+	if multipartUploadID.Valid {
+		_, abortErr = h.s3c.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   &h.cfg.S3.MediaBucket,
+			Key:      &resourceID,
+			UploadId: &multipartUploadID.String,
+		})
+	}
+	// the resource is pruned regardless, as the session is already gone
+	err := h.pruneResource(ctx, resourceID)
+	if abortErr != nil {
+		return abortErr
+	}
+	return err
+}
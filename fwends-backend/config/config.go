@@ -17,6 +17,18 @@ type Config struct {
 	Postgres PostgresConfig `mapstructure:",squash"`
 	Redis    RedisConfig    `mapstructure:",squash"`
 	S3       S3Config       `mapstructure:",squash"`
+
+	// request limits
+	Limits LimitsConfig `mapstructure:",squash"`
+
+	// media processing
+	Media MediaConfig `mapstructure:",squash"`
+
+	// resumable uploads
+	Uploads UploadsConfig `mapstructure:",squash"`
+
+	// pack validation rules
+	Validation ValidationConfig `mapstructure:",squash"`
 }
 
 func BindEnv(v *viper.Viper) {
@@ -37,10 +49,28 @@ func BindEnv(v *viper.Viper) {
 	v.BindEnv("redis_endpoint")
 	v.BindEnv("redis_password")
 	v.BindEnv("s3_endpoint")
+	v.BindEnv("s3_public_endpoint")
 	v.BindEnv("s3_region")
 	v.BindEnv("s3_access_key")
 	v.BindEnv("s3_secret_key")
 	v.BindEnv("s3_media_bucket")
+	v.BindEnv("s3_media_base_url")
+	v.BindEnv("max_image_size")
+	v.BindEnv("max_audio_size")
+	v.BindEnv("max_video_size")
+	v.BindEnv("max_text_size")
+	v.BindEnv("max_json_body_size")
+	v.BindEnv("strip_image_metadata")
+	v.BindEnv("audio_target_loudness")
+	v.BindEnv("media_url_ttl")
+	v.BindEnv("upload_session_ttl")
+	v.BindEnv("upload_presign_ttl")
+	v.BindEnv("validation_min_role_strings")
+	v.BindEnv("validation_max_image_size")
+	v.BindEnv("validation_max_audio_size")
+	v.BindEnv("validation_max_video_size")
+	v.BindEnv("validation_legacy_content_types")
+	v.BindEnv("validation_blocking_rules")
 }
 
 func SetDefaults(v *viper.Viper) {
@@ -53,4 +83,20 @@ func SetDefaults(v *viper.Viper) {
 	v.SetDefault("session_cookie", "fwends_session")
 	v.SetDefault("session_redis_prefix", "session/")
 	v.SetDefault("postgres_ssl_mode", "require")
+	v.SetDefault("max_image_size", 16*1024*1024)
+	v.SetDefault("max_audio_size", 32*1024*1024)
+	v.SetDefault("max_video_size", 512*1024*1024)
+	v.SetDefault("max_text_size", 64*1024)
+	v.SetDefault("max_json_body_size", 64*1024)
+	v.SetDefault("strip_image_metadata", true)
+	v.SetDefault("audio_target_loudness", -16.0)
+	v.SetDefault("media_url_ttl", time.Hour)
+	v.SetDefault("upload_session_ttl", 24*time.Hour)
+	v.SetDefault("upload_presign_ttl", 15*time.Minute)
+	v.SetDefault("validation_min_role_strings", 2)
+	v.SetDefault("validation_max_image_size", 2*1024*1024)
+	v.SetDefault("validation_max_audio_size", 2*1024*1024)
+	v.SetDefault("validation_max_video_size", 32*1024*1024)
+	v.SetDefault("validation_legacy_content_types", []string{})
+	v.SetDefault("validation_blocking_rules", []string{"no_strings", "missing_resources"})
 }
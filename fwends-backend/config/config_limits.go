@@ -0,0 +1,9 @@
+package config
+
+type LimitsConfig struct {
+	MaxImageSize    int64 `mapstructure:"max_image_size" validate:"gt=0"`
+	MaxAudioSize    int64 `mapstructure:"max_audio_size" validate:"gt=0"`
+	MaxVideoSize    int64 `mapstructure:"max_video_size" validate:"gt=0"`
+	MaxTextSize     int64 `mapstructure:"max_text_size" validate:"gt=0"`
+	MaxJSONBodySize int64 `mapstructure:"max_json_body_size" validate:"gt=0"`
+}
@@ -0,0 +1,9 @@
+package config
+
+import "time"
+
+type MediaConfig struct {
+	StripImageMetadata  bool          `mapstructure:"strip_image_metadata"`
+	AudioTargetLoudness float64       `mapstructure:"audio_target_loudness"`          // LUFS
+	MediaURLTTL         time.Duration `mapstructure:"media_url_ttl" validate:"gte=0"` // zero for unsigned urls
+}
@@ -1,9 +1,11 @@
 package config
 
 type S3Config struct {
-	Endpoint    string `mapstructure:"s3_endpoint" validate:"required"`
-	Region      string `mapstructure:"s3_region" validate:"required"`
-	AccessKey   string `mapstructure:"s3_access_key" validate:"required"`
-	SecretKey   string `mapstructure:"s3_secret_key" validate:"required"`
-	MediaBucket string `mapstructure:"s3_media_bucket" validate:"required"`
+	Endpoint       string `mapstructure:"s3_endpoint" validate:"required"`
+	PublicEndpoint string `mapstructure:"s3_public_endpoint"` // for presigned urls, defaults to the endpoint
+	Region         string `mapstructure:"s3_region" validate:"required"`
+	AccessKey      string `mapstructure:"s3_access_key" validate:"required"`
+	SecretKey      string `mapstructure:"s3_secret_key" validate:"required"`
+	MediaBucket    string `mapstructure:"s3_media_bucket" validate:"required"`
+	MediaBaseURL   string `mapstructure:"s3_media_base_url"` // for unsigned media urls, which need a public bucket or cdn, defaults to the bucket on the public endpoint
 }
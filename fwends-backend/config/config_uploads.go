@@ -0,0 +1,8 @@
+package config
+
+import "time"
+
+type UploadsConfig struct {
+	UploadSessionTTL time.Duration `mapstructure:"upload_session_ttl" validate:"gt=0"`
+	UploadPresignTTL time.Duration `mapstructure:"upload_presign_ttl" validate:"gt=0"` // capped at the session ttl
+}
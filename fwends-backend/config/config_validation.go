@@ -0,0 +1,10 @@
+package config
+
+type ValidationConfig struct {
+	MinRoleStrings     int      `mapstructure:"validation_min_role_strings" validate:"gte=0"`
+	MaxImageSize       int64    `mapstructure:"validation_max_image_size" validate:"gte=0"` // zero to not check
+	MaxAudioSize       int64    `mapstructure:"validation_max_audio_size" validate:"gte=0"` // zero to not check
+	MaxVideoSize       int64    `mapstructure:"validation_max_video_size" validate:"gte=0"` // zero to not check
+	LegacyContentTypes []string `mapstructure:"validation_legacy_content_types"`
+	BlockingRules      []string `mapstructure:"validation_blocking_rules" validate:"dive,oneof=no_strings missing_resources few_strings oversized_media legacy_content_type duplicate_media"` // prevent publishing
+}
@@ -0,0 +1,64 @@
+package game
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// The generator used by version 1 rounds is xoshiro256** 1.0, its state being the
+// sha-256 digest of the seed read as four 64-bit big-endian words. Its output must
+// never change, as pieces store seeds that are expected to give the same round on
+// every backend, so changes belong in a new version.
+//
+// see https://prng.di.unimi.it/xoshiro256starstar.c
+
+type xoshiro256 struct {
+	s [4]uint64
+}
+
+// every bit of the seed affects every word of the state, and the all zero state
+// that xoshiro cannot leave is as likely as finding a preimage of it
+func newXoshiro256(seed []byte) *xoshiro256 {
+	r := new(xoshiro256)
+	digest := sha256.Sum256(seed)
+	for i := range r.s {
+		r.s[i] = binary.BigEndian.Uint64(digest[i*8 : i*8+8])
+	}
+	return r
+}
+
+func (r *xoshiro256) next() uint64 {
+	result := rotl(r.s[1]*5, 7) * 9
+	t := r.s[1] << 17
+	r.s[2] ^= r.s[0]
+	r.s[3] ^= r.s[1]
+	r.s[1] ^= r.s[2]
+	r.s[0] ^= r.s[3]
+	r.s[2] ^= t
+	r.s[3] = rotl(r.s[3], 45)
+	return result
+}
+
+// a uniform integer in [0, n), outputs in the biased remainder of the range are
+// rejected rather than reduced
+func (r *xoshiro256) intn(n int) int {
+	bound := uint64(n)
+	threshold := -bound % bound // 2^64 mod n
+	for {
+		x := r.next()
+		if x >= threshold {
+			return int(x % bound)
+		}
+	}
+}
+
+// a fisher-yates shuffle, drawing from the last index down
+func (r *xoshiro256) shuffle(n int, swap func(i, j int)) {
+	for i := n - 1; i > 0; i-- {
+		swap(i, r.intn(i+1))
+	}
+}
+
+func rotl(x uint64, k uint) uint64 {
+	return (x << k) | (x >> (64 - k))
+}
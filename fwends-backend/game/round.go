@@ -0,0 +1,147 @@
+package game
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// Versions of round generation. A version fixes both the generator and the way its
+// output is drawn, so a seed gives the same round for as long as the version is
+// supported.
+const (
+	Version1      = 1
+	LatestVersion = Version1
+)
+
+// seeds are 128 bits
+const SeedSize = 16
+
+// A role of a pack, with the ids of its strings. Roles and their strings are given
+// in the order they are hashed in, sorted by id.
+type Role struct {
+	ID      string
+	Strings []string
+}
+
+type Options struct {
+	Players int
+	Roles   int // the number of roles to play with, or zero for one per player
+}
+
+type Round struct {
+	Version     int          `json:"version"`
+	Roles       []string     `json:"roles"`       // chosen roles, in the order they were drawn
+	Assignments []Assignment `json:"assignments"` // indexed by player
+	Order       []int        `json:"order"`       // players, in the order they take turns
+}
+
+// the role and string given to a player
+type Assignment struct {
+	Role   string `json:"role"`
+	String string `json:"string"`
+}
+
+// Hash returns the digest that identifies a pack's roles and strings, which pieces
+// are stored against.
+func Hash(roles []Role) []byte {
+	hash := sha256.New()
+	for _, role := range roles {
+		// hash write never returns an error, per https://pkg.go.dev/hash#Hash
+		_, _ = hash.Write([]byte{0})
+		_, _ = hash.Write([]byte(role.ID))
+		for _, stringID := range role.Strings {
+			_, _ = hash.Write([]byte{1})
+			_, _ = hash.Write([]byte(stringID))
+		}
+	}
+	return hash.Sum(nil)
+}
+
+// NewRound deterministically generates a round from a pack's roles and a seed.
+//
+// In version 1, the roles are shuffled and the first are chosen, then players are
+// dealt the chosen roles in turn. The strings of each chosen role are shuffled and
+// dealt to its players in turn, so that they are only repeated once every string
+// of the role is dealt. Finally the players are shuffled into the order they take
+// turns in.
+func NewRound(version int, roles []Role, seed []byte, options Options) (Round, error) {
+	if version != Version1 {
+		return Round{}, fmt.Errorf("unsupported round version: %d", version)
+	}
+	if len(seed) != SeedSize {
+		return Round{}, fmt.Errorf("round seed must be %d bytes", SeedSize)
+	}
+	if len(roles) == 0 {
+		return Round{}, errors.New("rounds need at least one role")
+	}
+	for _, role := range roles {
+		if len(role.Strings) == 0 {
+			return Round{}, fmt.Errorf("role %v has no strings", role.ID)
+		}
+	}
+	if options.Players < 1 {
+		return Round{}, errors.New("rounds need at least one player")
+	}
+	roleCount := options.Roles
+	if roleCount == 0 {
+		roleCount = options.Players
+	}
+	if roleCount > options.Players {
+		roleCount = options.Players
+	}
+	if roleCount > len(roles) {
+		roleCount = len(roles)
+	}
+	if roleCount < 1 {
+		return Round{}, errors.New("rounds need at least one role")
+	}
+
+	r := newXoshiro256(seed)
+	round := Round{Version: version}
+
+	// choose roles
+	order := make([]int, len(roles))
+	for i := range order {
+		order[i] = i
+	}
+	r.shuffle(len(order), func(i, j int) {
+		order[i], order[j] = order[j], order[i]
+	})
+	chosen := make([]Role, roleCount)
+	round.Roles = make([]string, roleCount)
+	for i := range chosen {
+		chosen[i] = roles[order[i]]
+		round.Roles[i] = chosen[i].ID
+	}
+
+	// deal strings, shuffling those of each role in the order the roles were drawn
+	dealt := make([][]string, roleCount)
+	for i, role := range chosen {
+		strings := append([]string(nil), role.Strings...)
+		r.shuffle(len(strings), func(i, j int) {
+			strings[i], strings[j] = strings[j], strings[i]
+		})
+		dealt[i] = strings
+	}
+	round.Assignments = make([]Assignment, options.Players)
+	for player := range round.Assignments {
+		role := player % roleCount
+		strings := dealt[role]
+		round.Assignments[player] = Assignment{
+			Role:   chosen[role].ID,
+			String: strings[(player/roleCount)%len(strings)],
+		}
+	}
+
+	// shuffle turn order
+	round.Order = make([]int, options.Players)
+	for i := range round.Order {
+		round.Order[i] = i
+	}
+	r.shuffle(len(round.Order), func(i, j int) {
+		round.Order[i], round.Order[j] = round.Order[j], round.Order[i]
+	})
+
+	return round, nil
+}
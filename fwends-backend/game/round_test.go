@@ -0,0 +1,200 @@
+package game
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// golden files pin the output of each version and must not change, those for a new
+// version are written with: go test ./game -update
+var update = flag.Bool("update", false, "update golden files")
+
+var testRoles = []Role{
+	{"bird", []string{"duck", "eagle", "robin"}},
+	{"insect", []string{"bee"}},
+	{"mammal", []string{"cat", "dog", "tiger"}},
+}
+
+var roundTests = []struct {
+	name    string
+	seed    string
+	options Options
+}{
+	{"one_player", "00000000000000000000000000000000", Options{Players: 1}},
+	{"role_per_player", "0123456789abcdef0123456789abcdef", Options{Players: 3}},
+	{"shared_roles", "0123456789abcdef0123456789abcdef", Options{Players: 8, Roles: 2}},
+	{"more_players_than_roles", "ffffffffffffffffffffffffffffffff", Options{Players: 7}},
+	{"other_seed", "3f9c0e5b7a2d4c61e8b0f7a29d5c1e43", Options{Players: 5, Roles: 3}},
+}
+
+func TestRoundGolden(t *testing.T) {
+	for _, tt := range roundTests {
+		t.Run(tt.name, func(t *testing.T) {
+			seed, _ := hex.DecodeString(tt.seed)
+			round, err := NewRound(Version1, testRoles, seed, tt.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.MarshalIndent(round, "", "\t")
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, fmt.Sprintf("round_v%d_%s.json", Version1, tt.name), append(data, '\n'))
+		})
+	}
+}
+
+func TestRoundDeterministic(t *testing.T) {
+	seed, _ := hex.DecodeString("0123456789abcdef0123456789abcdef")
+	options := Options{Players: 6}
+	first, err := NewRound(Version1, testRoles, seed, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		round, err := NewRound(Version1, testRoles, seed, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, _ := json.Marshal(first)
+		b, _ := json.Marshal(round)
+		if !bytes.Equal(a, b) {
+			t.Fatalf("round %d differs: %s != %s", i, b, a)
+		}
+	}
+}
+
+func TestRoundAssignments(t *testing.T) {
+	seed, _ := hex.DecodeString("0123456789abcdef0123456789abcdef")
+	round, err := NewRound(Version1, testRoles, seed, Options{Players: 6, Roles: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(round.Roles) != 2 || round.Roles[0] == round.Roles[1] {
+		t.Fatalf("expected two distinct roles, got %v", round.Roles)
+	}
+	// strings are only repeated within a role once all of them are dealt
+	dealt := make(map[string]map[string]int)
+	for player, assignment := range round.Assignments {
+		if assignment.Role != round.Roles[player%2] {
+			t.Fatalf("player %d has role %v, expected %v", player, assignment.Role, round.Roles[player%2])
+		}
+		if dealt[assignment.Role] == nil {
+			dealt[assignment.Role] = make(map[string]int)
+		}
+		dealt[assignment.Role][assignment.String]++
+	}
+	for _, role := range testRoles {
+		counts, ok := dealt[role.ID]
+		if !ok {
+			continue
+		}
+		for str, count := range counts {
+			if count > (6/2+len(role.Strings)-1)/len(role.Strings) {
+				t.Fatalf("string %v/%v dealt %d times", role.ID, str, count)
+			}
+		}
+	}
+	seen := make(map[int]bool)
+	for _, player := range round.Order {
+		if player < 0 || player >= 6 || seen[player] {
+			t.Fatalf("order is not a permutation of players: %v", round.Order)
+		}
+		seen[player] = true
+	}
+}
+
+func TestRoundErrors(t *testing.T) {
+	seed := make([]byte, SeedSize)
+	tests := []struct {
+		name    string
+		version int
+		roles   []Role
+		seed    []byte
+		options Options
+	}{
+		{"unknown_version", 0, testRoles, seed, Options{Players: 1}},
+		{"short_seed", Version1, testRoles, seed[:8], Options{Players: 1}},
+		{"no_roles", Version1, nil, seed, Options{Players: 1}},
+		{"no_strings", Version1, []Role{{"bird", nil}}, seed, Options{Players: 1}},
+		{"no_players", Version1, testRoles, seed, Options{}},
+		{"negative_roles", Version1, testRoles, seed, Options{Players: 1, Roles: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRound(tt.version, tt.roles, tt.seed, tt.options)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestPRNGGolden(t *testing.T) {
+	seed, _ := hex.DecodeString("0123456789abcdef0123456789abcdef")
+	r := newXoshiro256(seed)
+	var out bytes.Buffer
+	for i := 0; i < 16; i++ {
+		fmt.Fprintf(&out, "%016x\n", r.next())
+	}
+	for _, n := range []int{1, 2, 3, 7, 10, 1000} {
+		fmt.Fprintf(&out, "intn(%d) = %d\n", n, r.intn(n))
+	}
+	checkGolden(t, "prng_v1.txt", out.Bytes())
+}
+
+func TestPRNGEqualHalves(t *testing.T) {
+	// the halves of a seed must not seed halves of the state alike
+	for _, seed := range []string{"00000000000000000000000000000000", "0123456789abcdef0123456789abcdef"} {
+		b, _ := hex.DecodeString(seed)
+		r := newXoshiro256(b)
+		seen := make(map[uint64]bool)
+		for i := 0; i < 8; i++ {
+			x := r.next()
+			if seen[x] {
+				t.Fatalf("seed %v repeats output %016x", seed, x)
+			}
+			seen[x] = true
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	// matches the hash of the test pack in the integration tests
+	expected := "331b043c43ef7cc4b17fa10250dedeafcf427312067e398fb3b307582612ff06"
+	roles := []Role{
+		{"bird", []string{"duck", "eagle", "robin"}},
+		{"mammal", []string{"cat", "dog", "tiger"}},
+	}
+	if got := hex.EncodeToString(Hash(roles)); got != expected {
+		t.Fatalf("hash %v, expected %v", got, expected)
+	}
+	if got := hex.EncodeToString(Hash(nil)); got != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Fatalf("empty hash %v", got)
+	}
+}
+
+func checkGolden(t *testing.T, name string, actual []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		err := os.WriteFile(path, actual, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(actual, expected) {
+		t.Fatalf("output differs from %v:\n%s\nexpected:\n%s", path, actual, expected)
+	}
+}
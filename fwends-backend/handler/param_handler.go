@@ -0,0 +1,22 @@
+package handler
+
+import "net/http"
+
+// NewParamHandler dispatches to a handler by the value of a route parameter, for
+// routes that the router cannot tell apart from a parameter in the same position.
+// Values without a handler are not found.
+func NewParamHandler(param string, handlers map[string]Handler) Handler {
+	return &paramHandler{param, handlers}
+}
+
+type paramHandler struct {
+	param    string
+	handlers map[string]Handler
+}
+
+func (h *paramHandler) Handle(i Input) (int, error) {
+	if handler, ok := h.handlers[i.Params.ByName(h.param)]; ok {
+		return handler.Handle(i)
+	}
+	return http.StatusNotFound, nil
+}
@@ -0,0 +1,19 @@
+package handler
+
+// PublicError wraps an error whose message is safe to send to clients, so it is
+// included in default responses even when http debugging is disabled.
+type PublicError struct {
+	Err error
+}
+
+func NewPublicError(err error) error {
+	return &PublicError{err}
+}
+
+func (e *PublicError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PublicError) Unwrap() error {
+	return e.Err
+}
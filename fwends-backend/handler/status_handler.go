@@ -2,6 +2,7 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"go.uber.org/zap"
@@ -41,8 +42,11 @@ func (h StatusHandler) Handle(i Input) (int, error) {
 
 	// return a default response based on status if none was sent
 	if !wrap.HeaderWritten {
+		var publicErr *PublicError
 		if h.debug {
 			defaultHandlerResponse(i.Response, status, err)
+		} else if errors.As(err, &publicErr) {
+			defaultHandlerResponse(i.Response, status, publicErr)
 		} else {
 			// potentially sensitive errors shouldn't be sent to client in production
 			defaultHandlerResponse(i.Response, status, nil)
@@ -65,7 +69,9 @@ func defaultHandlerResponse(w http.ResponseWriter, status int, err error) {
 	resbody := defaultResponseBody{
 		Status:  status,
 		Message: http.StatusText(status),
-		Error:   err,
+	}
+	if err != nil {
+		resbody.Error = err.Error()
 	}
 	json.NewEncoder(w).Encode(resbody)
 }
@@ -105,5 +111,5 @@ func (w *responseWriterCapture) WriteHeader(status int) {
 type defaultResponseBody struct {
 	Status  int    `json:"status"`
 	Message string `json:"message"`
-	Error   error  `json:"error,omitempty"`
+	Error   string `json:"error,omitempty"`
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"fwends-backend/api"
@@ -9,6 +10,7 @@ import (
 	"fwends-backend/services"
 	"fwends-backend/util"
 	"net/http"
+	"os"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/go-playground/validator/v10"
@@ -23,9 +25,17 @@ func main() {
 	// the following functions are defined below and will panic if not successful
 	cfg := loadConfig()
 	logger := newLogger(cfg)
+
+	// maintenance commands are run in place of the server
+	if len(os.Args) > 1 {
+		runCommand(cfg, logger, os.Args[1:])
+		return
+	}
+
 	db := newPostgres(cfg)
 	rdb := newRedis(cfg)
 	s3c := newS3(cfg)
+	s3p := newS3Presigner(cfg, s3c)
 	podIndex := getPodIndex()
 	idgen := newIDGenerator(podIndex)
 
@@ -42,14 +52,39 @@ func main() {
 	router.POST("/api/auth", w(api.Authenticate(cfg, db, rdb)))
 	router.GET("/api/auth", w(api.AuthVerify(cfg, rdb)))
 	router.GET("/api/auth/config", w(api.AuthConfig(cfg)))
-	router.POST("/api/packs/", w(api.CreatePack(db, idgen)))
-	router.PUT("/api/packs/:pack_id", w(api.UpdatePack(db)))
-	router.GET("/api/packs/", w(api.ListPacks(cfg, db)))
-	router.GET("/api/packs/:pack_id", w(api.GetPack(cfg, db)))
+	router.POST("/api/packs/", w(api.CreatePack(cfg, db, idgen)))
+	router.PUT("/api/packs/:pack_id", w(api.UpdatePack(cfg, db, s3c)))
+	router.PATCH("/api/packs/:pack_id", w(api.UpdatePack(cfg, db, s3c)))
+	router.POST("/api/packs/:pack_id/cover", w(api.UploadPackCover(cfg, db, s3c, idgen)))
+	router.POST("/api/packs/:pack_id/publish", w(api.PublishPack(cfg, db, s3c)))
+	router.POST("/api/packs/:pack_id/archive", w(api.ArchivePack(cfg, db)))
+	router.GET("/api/packs/", w(api.ListPacks(cfg, db, rdb)))
+	router.GET("/api/packs/:pack_id", w(api.GetPack(cfg, db, rdb, s3p)))
+	router.GET("/api/packs/:pack_id/:role_id", w(handler.NewParamHandler("role_id", map[string]handler.Handler{
+		// reports on a pack share their position with role ids, which have no route of their own
+		"loudness": api.GetPackLoudness(cfg, db),
+		"validate": api.ValidatePack(cfg, db),
+	})))
+	router.GET("/api/packs/:pack_id/:role_id/:string_id/:class", w(api.GetPackResource(cfg, db, rdb, s3c)))
 	router.DELETE("/api/packs/:pack_id", w(api.DeletePack(cfg, db, s3c)))
 	router.DELETE("/api/packs/:pack_id/:role_id", w(api.DeletePackRole(cfg, db, s3c)))
+	router.PATCH("/api/packs/:pack_id/:role_id", w(api.UpdatePackRole(cfg, db)))
+	router.PATCH("/api/packs/:pack_id/:role_id/:string_id", w(api.UpdatePackString(cfg, db)))
 	router.DELETE("/api/packs/:pack_id/:role_id/:string_id", w(api.DeletePackString(cfg, db, s3c)))
 	router.PUT("/api/packs/:pack_id/:role_id/:string_id", w(api.UploadPackResource(cfg, db, s3c, idgen)))
+	router.GET("/api/resources/:resource_id/waveform", w(api.GetResourceWaveform(cfg, db, rdb)))
+	router.POST("/api/pieces/:hash/", w(api.CreatePiece(cfg, db)))
+	router.GET("/api/pieces/:hash/", w(api.ListPieces(cfg, db)))
+	router.GET("/api/pieces/:hash/:seed", w(api.GetPiece(cfg, db, rdb)))
+	router.DELETE("/api/pieces/:hash/:seed", w(api.DeletePiece(cfg, db)))
+	router.POST("/api/uploads/", w(api.CreateUpload(cfg, db, s3c, s3p, idgen)))
+	router.GET("/api/uploads/:upload_id", w(api.GetUpload(cfg, db)))
+	router.PATCH("/api/uploads/:upload_id", w(api.UploadChunk(cfg, db, s3c)))
+	router.DELETE("/api/uploads/:upload_id", w(api.DeleteUpload(cfg, db, s3c)))
+	router.POST("/api/uploads/:upload_id/finalize", w(api.FinalizeUpload(cfg, db, s3c, idgen)))
+
+	// abandoned uploads are discarded in the background
+	go api.ExpireUploadSessions(context.Background(), cfg, db, s3c, logger)
 
 	// start the server
 	logger.With(zap.Int64("podIndex", podIndex)).Info("starting http server")
@@ -60,6 +95,18 @@ func main() {
 	}
 }
 
+func runCommand(cfg *config.Config, logger *zap.Logger, args []string) {
+	switch args[0] {
+	case "backfill-blurhash":
+		err := api.BackfillBlurHashes(context.Background(), cfg, newPostgres(cfg), newS3(cfg), logger)
+		if err != nil {
+			logger.With(zap.Error(err)).Fatal("failed to backfill image blurhashes")
+		}
+	default:
+		logger.With(zap.String("command", args[0])).Fatal("unknown command")
+	}
+}
+
 func loadConfig() *config.Config {
 	cfg := &config.Config{}
 	v := viper.New()
@@ -105,6 +152,10 @@ func newS3(cfg *config.Config) *s3.Client {
 	return s3c
 }
 
+func newS3Presigner(cfg *config.Config, s3c *s3.Client) *s3.PresignClient {
+	return services.NewS3Presigner(&cfg.S3, s3c)
+}
+
 func getPodIndex() int64 {
 	podIndex, err := util.PodIndex()
 	if err != nil {
@@ -0,0 +1,46 @@
+package media
+
+import (
+	"io"
+	"math"
+)
+
+// AudioAnalysis describes the decoded samples of an audio resource.
+type AudioAnalysis struct {
+	// largest absolute amplitudes over equal spans of the audio, from zero to one
+	Peaks []float64
+	// integrated loudness in LUFS, negative infinity for silence
+	Loudness float64
+	// largest absolute sample in dBFS, negative infinity for silence
+	Peak float64
+}
+
+// AnalyzeAudio decodes a wav, flac or mp3 stream, and measures its loudness and
+// peak along with up to the given number of waveform peaks.
+func AnalyzeAudio(mediaType string, r io.Reader, peaks int) (AudioAnalysis, error) {
+	var waveform waveformBuilder
+	var loudness loudnessMeter
+	err := decodePCM(mediaType, r, pcmSinks{&waveform, &loudness})
+	if err != nil {
+		return AudioAnalysis{}, err
+	}
+	return AudioAnalysis{
+		Peaks:    waveform.peaks(peaks),
+		Loudness: loudness.integrated(),
+		Peak:     20 * math.Log10(loudness.peak),
+	}, nil
+}
+
+type pcmSinks []pcmSink
+
+func (s pcmSinks) start(sampleRate int, channels int) {
+	for _, sink := range s {
+		sink.start(sampleRate, channels)
+	}
+}
+
+func (s pcmSinks) add(frame []float64) {
+	for _, sink := range s {
+		sink.add(frame)
+	}
+}
@@ -0,0 +1,318 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// how far into a stream to look for the first frame, past any padding after tags
+const maxFrameSearchLength = 64 * 1024
+
+var mpegAudioBitrates = [2][3][16]int{
+	// mpeg 1, layers 1 to 3
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	},
+	// mpeg 2 and 2.5, layers 1 to 3
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	},
+}
+
+var mpegAudioSampleRates = [3]int{44100, 48000, 32000}
+
+type mpegAudioFrame struct {
+	length     int
+	samples    int
+	sampleRate int
+	channels   int
+	infoOffset int // where an info frame's tag would be, after the side information
+}
+
+// parses the four byte header of an mpeg audio frame
+func parseMPEGAudioFrame(h []byte) (mpegAudioFrame, bool) {
+	if h[0] != 0xFF || h[1]&0xE0 != 0xE0 {
+		return mpegAudioFrame{}, false
+	}
+	version := (h[1] >> 3) & 0x3 // 0 is mpeg 2.5, 2 is mpeg 2, 3 is mpeg 1
+	layer := 4 - int((h[1]>>1)&0x3)
+	bitrateIndex := h[2] >> 4
+	sampleRateIndex := (h[2] >> 2) & 0x3
+	if version == 1 || layer == 4 || bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		// reserved values, or a free format bitrate which is not supported
+		return mpegAudioFrame{}, false
+	}
+	table := 0
+	if version != 3 {
+		table = 1
+	}
+	bitrate := mpegAudioBitrates[table][layer-1][bitrateIndex] * 1000
+	frame := mpegAudioFrame{sampleRate: mpegAudioSampleRates[sampleRateIndex], channels: 2}
+	switch version {
+	case 2:
+		frame.sampleRate /= 2
+	case 0:
+		frame.sampleRate /= 4
+	}
+	if h[3]>>6 == 3 {
+		frame.channels = 1
+	}
+	switch {
+	case version == 3 && frame.channels == 1, version != 3 && frame.channels == 2:
+		frame.infoOffset = 4 + 17
+	case version == 3:
+		frame.infoOffset = 4 + 32
+	default:
+		frame.infoOffset = 4 + 9
+	}
+	padding := int(h[2]>>1) & 0x1
+	switch {
+	case layer == 1:
+		frame.samples = 384
+		frame.length = (12*bitrate/frame.sampleRate + padding) * 4
+	case layer == 3 && version != 3:
+		frame.samples = 576
+		frame.length = 72*bitrate/frame.sampleRate + padding
+	default:
+		frame.samples = 1152
+		frame.length = 144*bitrate/frame.sampleRate + padding
+	}
+	return frame, true
+}
+
+// counts every frame, so the duration is exact for variable bitrates
+func probeMP3(r io.Reader) (Metadata, error) {
+	br := bufio.NewReader(r)
+	err := skipID3(br)
+	if err != nil {
+		return Metadata{}, err
+	}
+	err = seekFrameSync(br)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	var meta Metadata
+	var samples int64
+	for frames := 0; ; frames++ {
+		header, err := br.Peek(4)
+		if err != nil && frames > 0 {
+			break
+		} else if err != nil {
+			return Metadata{}, err
+		}
+		frame, ok := parseMPEGAudioFrame(header)
+		if !ok && frames == 0 {
+			return Metadata{}, ErrUnsupported
+		} else if !ok {
+			// trailing tags
+			break
+		}
+		if frames == 0 && isMPEGAudioInfoFrame(br, frame) {
+			// encoders put a silent info frame first, it is not part of the audio
+		} else {
+			samples += int64(frame.samples)
+		}
+		meta.SampleRate = frame.sampleRate
+		meta.Channels = frame.channels
+		_, err = br.Discard(frame.length)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return Metadata{}, err
+		}
+	}
+	meta.Duration = samplesDuration(samples, meta.SampleRate)
+	return meta, nil
+}
+
+func isMPEGAudioInfoFrame(br *bufio.Reader, frame mpegAudioFrame) bool {
+	head, _ := br.Peek(frame.length)
+	for _, tag := range []struct {
+		offset int
+		value  string
+	}{{frame.infoOffset, "Xing"}, {frame.infoOffset, "Info"}, {4 + 32, "VBRI"}} {
+		if len(head) >= tag.offset+4 && string(head[tag.offset:tag.offset+4]) == tag.value {
+			return true
+		}
+	}
+	return false
+}
+
+var adtsSampleRates = [16]int{
+	96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350,
+}
+
+func probeADTS(r io.Reader) (Metadata, error) {
+	br := bufio.NewReader(r)
+	err := skipID3(br)
+	if err != nil {
+		return Metadata{}, err
+	}
+	if head, _ := br.Peek(4); bytes.Equal(head, []byte("ADIF")) {
+		return Metadata{}, ErrUnsupported
+	}
+	err = seekFrameSync(br)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	var meta Metadata
+	var samples int64
+	for frames := 0; ; frames++ {
+		header, err := br.Peek(7)
+		if err != nil && frames > 0 {
+			break
+		} else if err != nil {
+			return Metadata{}, err
+		}
+		if header[0] != 0xFF || header[1]&0xF6 != 0xF0 {
+			if frames == 0 {
+				return Metadata{}, ErrMalformed
+			}
+			// trailing tags
+			break
+		}
+		sampleRate := adtsSampleRates[(header[2]>>2)&0xF]
+		if sampleRate == 0 {
+			return Metadata{}, ErrMalformed
+		}
+		length := int(header[3]&0x3)<<11 | int(header[4])<<3 | int(header[5]>>5)
+		if length < 7 {
+			return Metadata{}, ErrMalformed
+		}
+		samples += 1024 * int64(header[6]&0x3+1)
+		meta.SampleRate = sampleRate
+		meta.Channels = int(header[2]&0x1)<<2 | int(header[3]>>6)
+		_, err = br.Discard(length)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return Metadata{}, err
+		}
+	}
+	meta.Duration = samplesDuration(samples, meta.SampleRate)
+	return meta, nil
+}
+
+// reads the format chunk, and the size of the data chunk that follows it
+func probeWAV(r io.Reader) (Metadata, error) {
+	header := make([]byte, 12)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return Metadata{}, err
+	} else if !isRIFF(header, "WAVE") {
+		return Metadata{}, ErrMalformed
+	}
+	var meta Metadata
+	var byteRate uint32
+	for {
+		_, err := io.ReadFull(r, header[:8])
+		if err != nil {
+			return Metadata{}, err
+		}
+		chunkID := string(header[0:4])
+		size := int64(binary.LittleEndian.Uint32(header[4:8]))
+		switch chunkID {
+		case "fmt ":
+			if size < 16 || size > 1024 {
+				return Metadata{}, ErrMalformed
+			}
+			format := make([]byte, size+size&1)
+			_, err := io.ReadFull(r, format)
+			if err != nil {
+				return Metadata{}, err
+			}
+			meta.Channels = int(binary.LittleEndian.Uint16(format[2:4]))
+			meta.SampleRate = int(binary.LittleEndian.Uint32(format[4:8]))
+			byteRate = binary.LittleEndian.Uint32(format[8:12])
+		case "data":
+			if byteRate == 0 {
+				return Metadata{}, errors.New("wav has no format before its data")
+			}
+			seconds := size / int64(byteRate)
+			remainder := size % int64(byteRate)
+			meta.Duration = time.Duration(seconds)*time.Second +
+				time.Duration(remainder)*time.Second/time.Duration(byteRate)
+			return meta, nil
+		default:
+			_, err := io.CopyN(io.Discard, r, size+size&1)
+			if err != nil {
+				return Metadata{}, err
+			}
+		}
+	}
+}
+
+// reads the stream info block, which is always the first metadata block
+func probeFLAC(r io.Reader) (Metadata, error) {
+	br := bufio.NewReader(r)
+	err := skipID3(br)
+	if err != nil {
+		return Metadata{}, err
+	}
+	header := make([]byte, 8+34)
+	_, err = io.ReadFull(br, header)
+	if err != nil {
+		return Metadata{}, err
+	}
+	if string(header[0:4]) != "fLaC" || header[4]&0x7F != 0 {
+		return Metadata{}, ErrMalformed
+	}
+	info := header[8:]
+	packed := binary.BigEndian.Uint64(info[10:18])
+	sampleRate := int(packed >> 44)
+	if sampleRate == 0 {
+		return Metadata{}, ErrMalformed
+	}
+	return Metadata{
+		SampleRate: sampleRate,
+		Channels:   int(packed>>41&0x7) + 1,
+		Duration:   samplesDuration(int64(packed&0xFFFFFFFFF), sampleRate),
+	}, nil
+}
+
+func skipID3(br *bufio.Reader) error {
+	header, err := br.Peek(10)
+	if err != nil || string(header[0:3]) != "ID3" {
+		return nil
+	}
+	// the size is syncsafe, seven bits per byte
+	size := int(header[6])<<21 | int(header[7])<<14 | int(header[8])<<7 | int(header[9])
+	if header[5]&0x10 != 0 {
+		size += 10 // footer
+	}
+	_, err = br.Discard(10 + size)
+	return err
+}
+
+// skips any padding before the first frame sync
+func seekFrameSync(br *bufio.Reader) error {
+	for skipped := 0; skipped < maxFrameSearchLength; skipped++ {
+		head, err := br.Peek(2)
+		if err != nil {
+			return err
+		}
+		if head[0] == 0xFF && head[1]&0xE0 == 0xE0 {
+			return nil
+		}
+		br.Discard(1)
+	}
+	return errors.New("no audio frames found")
+}
+
+func samplesDuration(samples int64, sampleRate int) time.Duration {
+	if sampleRate == 0 {
+		return 0
+	}
+	rate := int64(sampleRate)
+	return time.Duration(samples/rate)*time.Second + time.Duration(samples%rate)*time.Second/time.Duration(rate)
+}
@@ -0,0 +1,162 @@
+package media
+
+import (
+	"image"
+	"image/draw"
+	"math"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// see https://github.com/woltapp/blurhash/blob/master/Algorithm.md
+
+// images are shrunk before encoding, the components cannot hold any more detail
+const blurHashSourceSize = 64
+
+// more components along the longest side of the image
+const (
+	blurHashComponentsLong  = 4
+	blurHashComponentsShort = 3
+)
+
+const base83Characters = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// BlurHash encodes a jpeg, png, gif or webp image as a short string that can be
+// decoded into a blurred placeholder. The exif orientation of jpegs is applied.
+// Transparent pixels are treated as black.
+func BlurHash(mediaType string, b []byte) (string, error) {
+	src, orientation, err := decodeImage(mediaType, b)
+	if err != nil {
+		return "", err
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return "", ErrMalformed
+	}
+	if width > blurHashSourceSize || height > blurHashSourceSize {
+		// scale the longest side to the source size, keeping the aspect ratio
+		longest := width
+		if height > longest {
+			longest = height
+		}
+		width = (width*blurHashSourceSize + longest/2) / longest
+		height = (height*blurHashSourceSize + longest/2) / longest
+		if width < 1 {
+			width = 1
+		}
+		if height < 1 {
+			height = 1
+		}
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	xdraw.ApproxBiLinear.Scale(img, img.Bounds(), src, bounds, draw.Src, nil)
+	img = applyOrientation(img, orientation)
+
+	xComponents, yComponents := blurHashComponentsLong, blurHashComponentsShort
+	if img.Bounds().Dy() > img.Bounds().Dx() {
+		xComponents, yComponents = yComponents, xComponents
+	}
+	return encodeBlurHash(img, xComponents, yComponents), nil
+}
+
+func encodeBlurHash(img *image.NRGBA, xComponents int, yComponents int) string {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	// pixels in linear rgb, premultiplied by alpha
+	linear := make([][3]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := img.At(img.Bounds().Min.X+x, img.Bounds().Min.Y+y).RGBA()
+			linear[y*width+x] = [3]float64{
+				srgbToLinear(float64(r) / 0xFFFF),
+				srgbToLinear(float64(g) / 0xFFFF),
+				srgbToLinear(float64(b) / 0xFFFF),
+			}
+		}
+	}
+
+	// the cosine transform of the image, the first factor is the average color
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			var factor [3]float64
+			for y := 0; y < height; y++ {
+				basisY := math.Cos(math.Pi * float64(j) * float64(y) / float64(height))
+				for x := 0; x < width; x++ {
+					basis := basisY * math.Cos(math.Pi*float64(i)*float64(x)/float64(width))
+					pixel := linear[y*width+x]
+					factor[0] += basis * pixel[0]
+					factor[1] += basis * pixel[1]
+					factor[2] += basis * pixel[2]
+				}
+			}
+			scale := 2 / float64(width*height)
+			if i == 0 && j == 0 {
+				scale = 1 / float64(width*height)
+			}
+			factors = append(factors, [3]float64{factor[0] * scale, factor[1] * scale, factor[2] * scale})
+		}
+	}
+	dc, ac := factors[0], factors[1:]
+
+	var hash strings.Builder
+	hash.WriteString(encodeBase83((xComponents-1)+(yComponents-1)*9, 1))
+
+	// the ac components are quantized relative to the largest of them
+	maximum := 1.0
+	if len(ac) > 0 {
+		var actualMaximum float64
+		for _, factor := range ac {
+			for _, c := range factor {
+				actualMaximum = math.Max(actualMaximum, math.Abs(c))
+			}
+		}
+		quantizedMaximum := int(math.Max(0, math.Min(82, math.Floor(actualMaximum*166-0.5))))
+		maximum = float64(quantizedMaximum+1) / 166
+		hash.WriteString(encodeBase83(quantizedMaximum, 1))
+	} else {
+		hash.WriteString(encodeBase83(0, 1))
+	}
+
+	hash.WriteString(encodeBase83(linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4))
+	for _, factor := range ac {
+		var value int
+		for _, c := range factor {
+			quantized := int(math.Max(0, math.Min(18, math.Floor(signedSqrt(c/maximum)*9+9.5))))
+			value = value*19 + quantized
+		}
+		hash.WriteString(encodeBase83(value, 2))
+	}
+	return hash.String()
+}
+
+func encodeBase83(value int, length int) string {
+	encoded := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		encoded[i] = base83Characters[value%83]
+		value /= 83
+	}
+	return string(encoded)
+}
+
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) int {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signedSqrt(v float64) float64 {
+	return math.Copysign(math.Sqrt(math.Abs(v)), v)
+}
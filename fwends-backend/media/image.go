@@ -0,0 +1,40 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/webp"
+)
+
+// reads the dimensions from the header of an image, as it would be displayed
+func probeImage(mediaType string, r io.Reader) (Metadata, error) {
+	var config image.Config
+	var err error
+	switch mediaType {
+	case "image/jpeg":
+		// the segments before the frame header are kept to find the orientation
+		var head bytes.Buffer
+		config, err = jpeg.DecodeConfig(io.TeeReader(r, &head))
+		if err == nil && readJPEGOrientation(head.Bytes()) >= 5 {
+			// orientations 5 to 8 transpose the image
+			config.Width, config.Height = config.Height, config.Width
+		}
+	case "image/png":
+		config, err = png.DecodeConfig(r)
+	case "image/gif":
+		config, err = gif.DecodeConfig(r)
+	case "image/webp":
+		config, err = webp.DecodeConfig(r)
+	default:
+		return Metadata{}, ErrUnsupported
+	}
+	if err != nil {
+		return Metadata{}, ErrMalformed
+	}
+	return Metadata{Width: config.Width, Height: config.Height}, nil
+}
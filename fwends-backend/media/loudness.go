@@ -0,0 +1,172 @@
+package media
+
+import "math"
+
+// see https://www.itu.int/rec/R-REC-BS.1770
+
+// loudness is measured over 400ms blocks overlapping by 75%, which are summed
+// from 100ms segments
+const (
+	loudnessSegmentsPerSecond = 10
+	loudnessBlockSegments     = 4
+)
+
+const (
+	loudnessAbsoluteGate = -70 // LUFS
+	loudnessRelativeGate = -10 // LU below the loudness of the blocks above the absolute gate
+)
+
+// measures integrated loudness and sample peak
+type loudnessMeter struct {
+	filters       []kWeightingFilter
+	weights       []float64
+	segmentLength int
+	segmentFrames int
+	segmentEnergy float64
+	segments      []float64 // channel weighted energy of each complete segment
+	peak          float64
+}
+
+func (m *loudnessMeter) start(sampleRate int, channels int) {
+	m.filters = make([]kWeightingFilter, channels)
+	m.weights = make([]float64, channels)
+	for c := range m.filters {
+		m.filters[c] = newKWeightingFilter(float64(sampleRate))
+		m.weights[c] = 1
+	}
+	if channels == 6 {
+		// 5.1, the low frequency channel is ignored and the surround channels are boosted
+		m.weights[3] = 0
+		m.weights[4] = 1.41
+		m.weights[5] = 1.41
+	}
+	m.segmentLength = sampleRate / loudnessSegmentsPerSecond
+	if m.segmentLength < 1 {
+		m.segmentLength = 1
+	}
+}
+
+func (m *loudnessMeter) add(frame []float64) {
+	for c, sample := range frame {
+		m.peak = math.Max(m.peak, math.Abs(sample))
+		filtered := m.filters[c].process(sample)
+		m.segmentEnergy += m.weights[c] * filtered * filtered
+	}
+	m.segmentFrames++
+	if m.segmentFrames == m.segmentLength {
+		m.segments = append(m.segments, m.segmentEnergy)
+		m.segmentEnergy = 0
+		m.segmentFrames = 0
+	}
+}
+
+func (m *loudnessMeter) integrated() float64 {
+	var blocks []float64
+	blockLength := float64(loudnessBlockSegments * m.segmentLength)
+	for i := 0; i+loudnessBlockSegments <= len(m.segments); i++ {
+		var energy float64
+		for _, segment := range m.segments[i : i+loudnessBlockSegments] {
+			energy += segment
+		}
+		blocks = append(blocks, energy/blockLength)
+	}
+	if blocks == nil {
+		// clips shorter than a block are measured as a whole rather than not at all
+		frames := len(m.segments)*m.segmentLength + m.segmentFrames
+		if frames == 0 {
+			return math.Inf(-1)
+		}
+		energy := m.segmentEnergy
+		for _, segment := range m.segments {
+			energy += segment
+		}
+		blocks = []float64{energy / float64(frames)}
+	}
+
+	absolute := gatedMeanSquare(blocks, loudnessMeanSquare(loudnessAbsoluteGate))
+	if absolute == 0 {
+		return math.Inf(-1)
+	}
+	relative := absolute * math.Pow(10, loudnessRelativeGate/10.0)
+	return loudnessLevel(gatedMeanSquare(blocks, math.Max(relative, loudnessMeanSquare(loudnessAbsoluteGate))))
+}
+
+// mean of the blocks above the gate, or zero if there are none
+func gatedMeanSquare(blocks []float64, gate float64) float64 {
+	var sum float64
+	var count int
+	for _, block := range blocks {
+		if block > gate {
+			sum += block
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+func loudnessLevel(meanSquare float64) float64 {
+	return -0.691 + 10*math.Log10(meanSquare)
+}
+
+func loudnessMeanSquare(level float64) float64 {
+	return math.Pow(10, (level+0.691)/10)
+}
+
+// a high shelf modelling the head followed by a high pass, with coefficients
+// derived for the sample rate rather than the 48kHz tables in the standard
+type kWeightingFilter struct {
+	stages [2]biquad
+}
+
+func newKWeightingFilter(sampleRate float64) kWeightingFilter {
+	var f kWeightingFilter
+
+	// high shelf
+	k := math.Tan(math.Pi * 1681.974450955533 / sampleRate)
+	q := 0.7071752369554196
+	vh := math.Pow(10, 3.999843853973347/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	f.stages[0] = biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	// high pass
+	k = math.Tan(math.Pi * 38.13547087602444 / sampleRate)
+	q = 0.5003270373238773
+	a0 = 1 + k/q + k*k
+	f.stages[1] = biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return f
+}
+
+func (f *kWeightingFilter) process(x float64) float64 {
+	for i := range f.stages {
+		x = f.stages[i].process(x)
+	}
+	return x
+}
+
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (b *biquad) process(x float64) float64 {
+	y := b.b0*x + b.b1*b.x1 + b.b2*b.x2 - b.a1*b.y1 - b.a2*b.y2
+	b.x2, b.x1 = b.x1, x
+	b.y2, b.y1 = b.y1, y
+	return y
+}
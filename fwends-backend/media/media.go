@@ -0,0 +1,42 @@
+package media
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// Metadata describes a media resource, fields are zero when they do not apply.
+type Metadata struct {
+	Width      int
+	Height     int
+	Duration   time.Duration
+	SampleRate int
+	Channels   int
+}
+
+var ErrUnsupported = errors.New("media type is not supported")
+var ErrMalformed = errors.New("media is malformed")
+
+// Probe reads the metadata of a media stream with the given media type.
+// Only as much of the stream as is needed is read.
+func Probe(mediaType string, r io.Reader) (Metadata, error) {
+	switch mediaType {
+	case "video/mp4", "audio/mp4":
+		return probeMP4(r)
+	case "video/webm":
+		return probeWebM(r)
+	case "audio/mpeg":
+		return probeMP3(r)
+	case "audio/aac":
+		return probeADTS(r)
+	case "audio/wav":
+		return probeWAV(r)
+	case "audio/flac":
+		return probeFLAC(r)
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return probeImage(mediaType, r)
+	default:
+		return Metadata{}, ErrUnsupported
+	}
+}
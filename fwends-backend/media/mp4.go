@@ -0,0 +1,218 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// see https://developer.apple.com/library/archive/documentation/QuickTime/QTFF/QTFFChap2/qtff2.html
+
+// the moov box is buffered in memory, it is usually well under a megabyte
+const maxMP4MoovSize = 16 * 1024 * 1024
+
+// reads the top-level boxes until the moov box is found
+func probeMP4(r io.Reader) (Metadata, error) {
+	header := make([]byte, 16)
+	for {
+		_, err := io.ReadFull(r, header[:8])
+		if err == io.EOF {
+			return Metadata{}, errors.New("mp4 has no moov box")
+		} else if err != nil {
+			return Metadata{}, err
+		}
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		boxType := string(header[4:8])
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			// box extends to the end of the file, so there is nothing after it
+			return Metadata{}, errors.New("mp4 has no moov box")
+		case 1:
+			_, err := io.ReadFull(r, header[8:16])
+			if err != nil {
+				return Metadata{}, err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if size < headerSize {
+			return Metadata{}, ErrMalformed
+		}
+		payloadSize := size - headerSize
+		if boxType != "moov" {
+			_, err := io.CopyN(io.Discard, r, payloadSize)
+			if err != nil {
+				return Metadata{}, err
+			}
+			continue
+		}
+		if payloadSize > maxMP4MoovSize {
+			return Metadata{}, errors.New("mp4 moov box is too large")
+		}
+		moov := make([]byte, payloadSize)
+		_, err = io.ReadFull(r, moov)
+		if err != nil {
+			return Metadata{}, err
+		}
+		return parseMP4Moov(moov)
+	}
+}
+
+func parseMP4Moov(moov []byte) (Metadata, error) {
+	var meta Metadata
+	err := forEachMP4Box(moov, func(boxType string, payload []byte) error {
+		switch boxType {
+		case "mvhd":
+			duration, err := parseMP4Mvhd(payload)
+			if err != nil {
+				return err
+			}
+			meta.Duration = duration
+		case "trak":
+			return forEachMP4Box(payload, func(boxType string, payload []byte) error {
+				switch boxType {
+				case "tkhd":
+					// the first track with dimensions is taken to be the video track
+					if meta.Width != 0 {
+						return nil
+					}
+					width, height, err := parseMP4Tkhd(payload)
+					if err != nil {
+						return err
+					}
+					meta.Width, meta.Height = width, height
+				case "mdia":
+					// likewise the first track with an audio sample entry is the audio track
+					if meta.SampleRate != 0 {
+						return nil
+					}
+					return forEachMP4BoxPath(payload, []string{"minf", "stbl", "stsd"}, func(stsd []byte) error {
+						sampleRate, channels, err := parseMP4AudioSampleDescription(stsd)
+						if err != nil {
+							return err
+						}
+						meta.SampleRate, meta.Channels = sampleRate, channels
+						return nil
+					})
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return meta, err
+}
+
+func parseMP4Mvhd(b []byte) (time.Duration, error) {
+	var timescale, duration uint64
+	switch {
+	case len(b) >= 20 && b[0] == 0:
+		timescale = uint64(binary.BigEndian.Uint32(b[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(b[16:20]))
+	case len(b) >= 32 && b[0] == 1:
+		timescale = uint64(binary.BigEndian.Uint32(b[20:24]))
+		duration = binary.BigEndian.Uint64(b[24:32])
+	default:
+		return 0, ErrMalformed
+	}
+	if timescale == 0 {
+		return 0, ErrMalformed
+	}
+	seconds := duration / timescale
+	remainder := duration % timescale
+	return time.Duration(seconds)*time.Second + time.Duration(remainder)*time.Second/time.Duration(timescale), nil
+}
+
+func parseMP4Tkhd(b []byte) (int, int, error) {
+	// version and flags, then version dependent times and durations
+	var offset int
+	switch {
+	case len(b) > 0 && b[0] == 0:
+		offset = 4 + 20
+	case len(b) > 0 && b[0] == 1:
+		offset = 4 + 32
+	default:
+		return 0, 0, ErrMalformed
+	}
+	// reserved, layer, alternate group, volume, reserved and matrix
+	offset += 8 + 2 + 2 + 2 + 2 + 36
+	if len(b) < offset+8 {
+		return 0, 0, ErrMalformed
+	}
+	// 16.16 fixed point
+	width := binary.BigEndian.Uint32(b[offset:offset+4]) >> 16
+	height := binary.BigEndian.Uint32(b[offset+4:offset+8]) >> 16
+	return int(width), int(height), nil
+}
+
+// reads the channels and sample rate of the first sample entry, if it is audio
+func parseMP4AudioSampleDescription(b []byte) (int, int, error) {
+	// version, flags and entry count precede the entries
+	if len(b) < 8 {
+		return 0, 0, ErrMalformed
+	}
+	var sampleRate, channels int
+	found := false
+	err := forEachMP4Box(b[8:], func(boxType string, payload []byte) error {
+		if found {
+			return nil
+		}
+		found = true
+		if boxType != "mp4a" {
+			return nil
+		}
+		// reserved, data reference index, version, revision and vendor
+		if len(payload) < 28 {
+			return ErrMalformed
+		}
+		channels = int(binary.BigEndian.Uint16(payload[16:18]))
+		// 16.16 fixed point
+		sampleRate = int(binary.BigEndian.Uint32(payload[24:28]) >> 16)
+		return nil
+	})
+	return sampleRate, channels, err
+}
+
+// calls fn with the payload of each box found by following the path of box types
+func forEachMP4BoxPath(b []byte, path []string, fn func(payload []byte) error) error {
+	return forEachMP4Box(b, func(boxType string, payload []byte) error {
+		if boxType != path[0] {
+			return nil
+		} else if len(path) == 1 {
+			return fn(payload)
+		}
+		return forEachMP4BoxPath(payload, path[1:], fn)
+	})
+}
+
+func forEachMP4Box(b []byte, fn func(boxType string, payload []byte) error) error {
+	for len(b) > 0 {
+		if len(b) < 8 {
+			return ErrMalformed
+		}
+		size := uint64(binary.BigEndian.Uint32(b[0:4]))
+		boxType := string(b[4:8])
+		headerSize := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(b))
+		case 1:
+			if len(b) < 16 {
+				return ErrMalformed
+			}
+			size = binary.BigEndian.Uint64(b[8:16])
+			headerSize = 16
+		}
+		if size < headerSize || size > uint64(len(b)) {
+			return ErrMalformed
+		}
+		err := fn(boxType, b[headerSize:size])
+		if err != nil {
+			return err
+		}
+		b = b[size:]
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package media
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/hajimehoshi/go-mp3"
+	"github.com/mewkiz/flac"
+)
+
+// receives decoded audio one frame at a time, each holding a sample per channel
+// from -1 to 1. frames are reused, so they must not be retained.
+type pcmSink interface {
+	start(sampleRate int, channels int)
+	add(frame []float64)
+}
+
+// decodes a wav, flac or mp3 stream to a sink
+func decodePCM(mediaType string, r io.Reader, sink pcmSink) error {
+	switch mediaType {
+	case "audio/wav":
+		return decodeWAV(r, sink)
+	case "audio/flac":
+		return decodeFLAC(r, sink)
+	case "audio/mpeg":
+		return decodeMP3(r, sink)
+	default:
+		return ErrUnsupported
+	}
+}
+
+func decodeWAV(r io.Reader, sink pcmSink) error {
+	br := bufio.NewReader(r)
+	header := make([]byte, 12)
+	_, err := io.ReadFull(br, header)
+	if err != nil {
+		return err
+	} else if !isRIFF(header, "WAVE") {
+		return ErrMalformed
+	}
+	var format []byte
+	for {
+		_, err := io.ReadFull(br, header[:8])
+		if err != nil {
+			return err
+		}
+		chunkID := string(header[0:4])
+		size := int64(binary.LittleEndian.Uint32(header[4:8]))
+		if chunkID == "data" {
+			break
+		} else if chunkID == "fmt " {
+			if size < 16 || size > 1024 {
+				return ErrMalformed
+			}
+			format = make([]byte, size+size&1)
+			_, err = io.ReadFull(br, format)
+		} else {
+			_, err = io.CopyN(io.Discard, br, size+size&1)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if format == nil {
+		return errors.New("wav has no format before its data")
+	}
+
+	formatTag := binary.LittleEndian.Uint16(format[0:2])
+	channels := int(binary.LittleEndian.Uint16(format[2:4]))
+	sampleRate := int(binary.LittleEndian.Uint32(format[4:8]))
+	bitsPerSample := int(binary.LittleEndian.Uint16(format[14:16]))
+	if formatTag == 0xFFFE && len(format) >= 26 {
+		// extensible format, the actual format is at the start of the sub format guid
+		formatTag = binary.LittleEndian.Uint16(format[24:26])
+	}
+	bytesPerSample := bitsPerSample / 8
+	isFloat := formatTag == 3
+	switch {
+	case channels == 0 || sampleRate == 0:
+		return ErrMalformed
+	case formatTag == 1 && bytesPerSample >= 1 && bytesPerSample <= 4 && bitsPerSample%8 == 0:
+	case isFloat && bitsPerSample == 32:
+	default:
+		return ErrUnsupported
+	}
+
+	// the data chunk size is ignored, as streaming encoders leave it unset
+	sink.start(sampleRate, channels)
+	frame := make([]byte, channels*bytesPerSample)
+	samples := make([]float64, channels)
+	for {
+		_, err := io.ReadFull(br, frame)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		for c := 0; c < channels; c++ {
+			sample := frame[c*bytesPerSample : (c+1)*bytesPerSample]
+			var value float64
+			switch {
+			case isFloat:
+				value = float64(math.Float32frombits(binary.LittleEndian.Uint32(sample)))
+			case bytesPerSample == 1:
+				// 8 bit samples are unsigned
+				value = float64(int(sample[0])-128) / 128
+			default:
+				// sign extend from the most significant byte
+				v := int64(int8(sample[bytesPerSample-1]))
+				for i := bytesPerSample - 2; i >= 0; i-- {
+					v = v<<8 | int64(sample[i])
+				}
+				value = float64(v) / float64(int64(1)<<(bitsPerSample-1))
+			}
+			samples[c] = value
+		}
+		sink.add(samples)
+	}
+}
+
+func decodeFLAC(r io.Reader, sink pcmSink) error {
+	stream, err := flac.New(r)
+	if err != nil {
+		return ErrMalformed
+	}
+	if stream.Info.SampleRate == 0 || stream.Info.BitsPerSample == 0 {
+		return ErrMalformed
+	}
+	scale := float64(int64(1) << (stream.Info.BitsPerSample - 1))
+	sink.start(int(stream.Info.SampleRate), int(stream.Info.NChannels))
+	samples := make([]float64, stream.Info.NChannels)
+	for {
+		frame, err := stream.ParseNext()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return ErrMalformed
+		}
+		if len(frame.Subframes) != len(samples) {
+			return ErrMalformed
+		}
+		for i := 0; i < int(frame.BlockSize); i++ {
+			for c, subframe := range frame.Subframes {
+				samples[c] = float64(subframe.Samples[i]) / scale
+			}
+			sink.add(samples)
+		}
+	}
+}
+
+func decodeMP3(r io.Reader, sink pcmSink) error {
+	// the decoder always outputs stereo, so the channel count is read from the
+	// first frame header to undo that for mono streams
+	br := bufio.NewReader(r)
+	err := skipID3(br)
+	if err != nil {
+		return err
+	}
+	err = seekFrameSync(br)
+	if err != nil {
+		return err
+	}
+	header, err := br.Peek(4)
+	if err != nil {
+		return err
+	}
+	first, ok := parseMPEGAudioFrame(header)
+	if !ok {
+		return ErrMalformed
+	}
+
+	decoder, err := mp3.NewDecoder(br)
+	if err != nil {
+		return ErrMalformed
+	}
+	sink.start(decoder.SampleRate(), first.channels)
+	// decoded as 16 bit little endian stereo
+	dr := bufio.NewReader(decoder)
+	frame := make([]byte, 4)
+	samples := make([]float64, 2)
+	for {
+		_, err := io.ReadFull(dr, frame)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		} else if err != nil {
+			return ErrMalformed
+		}
+		samples[0] = float64(int16(binary.LittleEndian.Uint16(frame[0:2]))) / 32768
+		samples[1] = float64(int16(binary.LittleEndian.Uint16(frame[2:4]))) / 32768
+		sink.add(samples[:first.channels])
+	}
+}
@@ -0,0 +1,97 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// SniffLength is the number of leading bytes that Sniff needs to see.
+const SniffLength = 512
+
+// Sniff reports whether the leading bytes of a stream are consistent with its
+// media type, using the magic numbers of each format. Shorter input is allowed.
+func Sniff(mediaType string, head []byte) bool {
+	switch mediaType {
+	case "image/png":
+		return bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n"))
+	case "image/jpeg":
+		return bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF})
+	case "image/gif":
+		return bytes.HasPrefix(head, []byte("GIF87a")) || bytes.HasPrefix(head, []byte("GIF89a"))
+	case "image/webp":
+		return isRIFF(head, "WEBP")
+	case "image/avif":
+		return hasFtypBrand(head, "avif", "avis")
+	case "image/svg+xml":
+		return isSVG(head)
+	case "audio/mpeg":
+		return hasID3(head) || isMPEGAudioFrame(head, false)
+	case "audio/aac":
+		return hasID3(head) || isMPEGAudioFrame(head, true) || bytes.HasPrefix(head, []byte("ADIF"))
+	case "audio/wav":
+		return isRIFF(head, "WAVE")
+	case "audio/flac":
+		return hasID3(head) || bytes.HasPrefix(head, []byte("fLaC"))
+	case "audio/ogg":
+		return bytes.HasPrefix(head, []byte("OggS"))
+	case "audio/mp4", "video/mp4":
+		return len(head) >= 8 && string(head[4:8]) == "ftyp"
+	case "video/webm":
+		return bytes.HasPrefix(head, []byte{0x1A, 0x45, 0xDF, 0xA3})
+	default:
+		return false
+	}
+}
+
+func isRIFF(head []byte, format string) bool {
+	return len(head) >= 12 && string(head[0:4]) == "RIFF" && string(head[8:12]) == format
+}
+
+func hasID3(head []byte) bool {
+	return bytes.HasPrefix(head, []byte("ID3"))
+}
+
+// mpeg audio frames start with 11 sync bits, adts frames set the layer bits to zero
+func isMPEGAudioFrame(head []byte, adts bool) bool {
+	if len(head) < 2 || head[0] != 0xFF || head[1]&0xE0 != 0xE0 {
+		return false
+	}
+	layer := (head[1] >> 1) & 0x3
+	if adts {
+		return head[1]&0xF0 == 0xF0 && layer == 0
+	}
+	return layer != 0
+}
+
+// checks the major and compatible brands of an iso base media file type box
+func hasFtypBrand(head []byte, brands ...string) bool {
+	if len(head) < 16 || string(head[4:8]) != "ftyp" {
+		return false
+	}
+	size := int(binary.BigEndian.Uint32(head[0:4]))
+	if size > len(head) {
+		size = len(head)
+	}
+	for offset := 8; offset+4 <= size; offset += 4 {
+		if offset == 12 {
+			continue // minor version
+		}
+		for _, brand := range brands {
+			if string(head[offset:offset+4]) == brand {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// svg is xml, so it is only possible to check that it starts with markup and
+// that an svg element appears early on
+func isSVG(head []byte) bool {
+	head = bytes.TrimPrefix(head, []byte("\xEF\xBB\xBF"))
+	head = bytes.TrimLeft(head, " \t\r\n")
+	if !bytes.HasPrefix(head, []byte("<")) {
+		return false
+	}
+	return bytes.Contains(bytes.ToLower(head), []byte("<svg"))
+}
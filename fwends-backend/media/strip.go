@@ -0,0 +1,278 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+// StripMetadata removes exif, xmp, iptc and text metadata from a jpeg, png or
+// webp image without touching its pixel data. Color profiles are kept, and so is
+// the exif orientation, as browsers use it to rotate the image.
+func StripMetadata(mediaType string, b []byte) ([]byte, error) {
+	switch mediaType {
+	case "image/jpeg":
+		return stripJPEGMetadata(b)
+	case "image/png":
+		return stripPNGMetadata(b)
+	case "image/webp":
+		return stripWebPMetadata(b)
+	default:
+		return nil, ErrUnsupported
+	}
+}
+
+const (
+	jpegSOI  = 0xD8
+	jpegSOS  = 0xDA
+	jpegAPP0 = 0xE0
+	jpegAPP1 = 0xE1
+	jpegAPP2 = 0xE2
+	jpegAPPE = 0xEE
+	jpegAPPF = 0xEF
+	jpegCOM  = 0xFE
+)
+
+// copies segments up to the start of scan, after which there is only entropy coded data
+func stripJPEGMetadata(b []byte) ([]byte, error) {
+	if len(b) < 2 || b[0] != 0xFF || b[1] != jpegSOI {
+		return nil, ErrMalformed
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(b)))
+	out.Write(b[:2])
+	b = b[2:]
+	for {
+		if len(b) < 2 || b[0] != 0xFF {
+			return nil, ErrMalformed
+		}
+		marker := b[1]
+		if marker == 0xFF {
+			// fill byte
+			b = b[1:]
+			continue
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			// standalone markers have no length
+			out.Write(b[:2])
+			b = b[2:]
+			continue
+		}
+		if len(b) < 4 {
+			return nil, ErrMalformed
+		}
+		size := 2 + int(binary.BigEndian.Uint16(b[2:4]))
+		if size < 4 || size > len(b) {
+			return nil, ErrMalformed
+		}
+		segment, payload := b[:size], b[4:size]
+		b = b[size:]
+		switch {
+		case marker == jpegSOS:
+			out.Write(segment)
+			out.Write(b)
+			return out.Bytes(), nil
+		case marker == jpegAPP1 && bytes.HasPrefix(payload, []byte("Exif\x00\x00")):
+			exif := minimalExif(payload[6:])
+			if exif != nil {
+				exif = append([]byte("Exif\x00\x00"), exif...)
+				out.Write([]byte{0xFF, jpegAPP1})
+				binary.Write(out, binary.BigEndian, uint16(2+len(exif)))
+				out.Write(exif)
+			}
+		case marker == jpegAPP0 && (bytes.HasPrefix(payload, []byte("JFIF\x00")) || bytes.HasPrefix(payload, []byte("JFXX\x00"))),
+			marker == jpegAPP2 && bytes.HasPrefix(payload, []byte("ICC_PROFILE\x00")),
+			marker == jpegAPPE && bytes.HasPrefix(payload, []byte("Adobe")):
+			// needed to decode colors correctly
+			out.Write(segment)
+		case marker >= jpegAPP0 && marker <= jpegAPPF, marker == jpegCOM:
+			// exif, xmp, iptc, comments and vendor specific data
+		default:
+			out.Write(segment)
+		}
+	}
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// ancillary chunks that carry metadata rather than anything needed to display the image
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+func stripPNGMetadata(b []byte) ([]byte, error) {
+	if !bytes.HasPrefix(b, pngSignature) {
+		return nil, ErrMalformed
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(b)))
+	out.Write(pngSignature)
+	b = b[len(pngSignature):]
+	for len(b) > 0 {
+		if len(b) < 12 {
+			return nil, ErrMalformed
+		}
+		size := binary.BigEndian.Uint32(b[0:4])
+		if uint64(size)+12 > uint64(len(b)) {
+			return nil, ErrMalformed
+		}
+		chunkType := string(b[4:8])
+		chunk, payload := b[:12+size], b[8:8+size]
+		b = b[12+size:]
+		if chunkType == "eXIf" {
+			exif := minimalExif(payload)
+			if exif != nil {
+				binary.Write(out, binary.BigEndian, uint32(len(exif)))
+				crc := crc32.NewIEEE()
+				crc.Write([]byte(chunkType))
+				crc.Write(exif)
+				out.WriteString(chunkType)
+				out.Write(exif)
+				binary.Write(out, binary.BigEndian, crc.Sum32())
+			}
+		} else if !pngMetadataChunks[chunkType] {
+			out.Write(chunk)
+		}
+		if chunkType == "IEND" {
+			break
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// flags in the first byte of the extended webp header
+const (
+	webpFlagExif = 0x08
+	webpFlagXMP  = 0x04
+)
+
+func stripWebPMetadata(b []byte) ([]byte, error) {
+	if !isRIFF(b, "WEBP") {
+		return nil, ErrMalformed
+	}
+	// the riff size counts the form type, so anything smaller is malformed
+	riffSize := uint64(binary.LittleEndian.Uint32(b[4:8]))
+	if riffSize < 4 {
+		return nil, ErrMalformed
+	}
+	if riffSize+8 < uint64(len(b)) {
+		b = b[:riffSize+8]
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(b)))
+	out.Write(b[:12])
+	b = b[12:]
+	vp8xOffset := -1
+	var hasExif bool
+	for len(b) > 0 {
+		if len(b) < 8 {
+			return nil, ErrMalformed
+		}
+		fourCC := string(b[0:4])
+		size := uint64(binary.LittleEndian.Uint32(b[4:8]))
+		padded := size + size&1
+		if 8+padded > uint64(len(b)) {
+			// the final padding byte is sometimes missing
+			if 8+size != uint64(len(b)) {
+				return nil, ErrMalformed
+			}
+			padded = size
+		}
+		chunk, payload := b[:8+padded], b[8:8+size]
+		b = b[8+padded:]
+		switch fourCC {
+		case "VP8X":
+			if size < 1 {
+				return nil, ErrMalformed
+			}
+			vp8xOffset = out.Len()
+			out.Write(chunk)
+		case "EXIF":
+			exif := minimalExif(bytes.TrimPrefix(payload, []byte("Exif\x00\x00")))
+			if exif != nil {
+				hasExif = true
+				out.WriteString(fourCC)
+				binary.Write(out, binary.LittleEndian, uint32(len(exif)))
+				out.Write(exif)
+				if len(exif)&1 == 1 {
+					out.WriteByte(0)
+				}
+			}
+		case "XMP ":
+			// dropped, its flag is cleared below
+		default:
+			out.Write(chunk)
+		}
+	}
+
+	stripped := out.Bytes()
+	if len(stripped)&1 == 1 {
+		stripped = append(stripped, 0)
+	}
+	binary.LittleEndian.PutUint32(stripped[4:8], uint32(len(stripped)-8))
+	if vp8xOffset != -1 {
+		flags := &stripped[vp8xOffset+8]
+		*flags &^= webpFlagExif | webpFlagXMP
+		if hasExif {
+			*flags |= webpFlagExif
+		}
+	}
+	return stripped, nil
+}
+
+const exifOrientationTag = 0x0112
+
+// returns an exif block holding only the orientation of the image, or nil if the
+// orientation is missing or is the default
+func minimalExif(tiff []byte) []byte {
+	orientation, err := readExifOrientation(tiff)
+	if err != nil || orientation <= 1 || orientation > 8 {
+		return nil
+	}
+	exif := make([]byte, 26)
+	copy(exif[0:4], "MM\x00\x2A")
+	binary.BigEndian.PutUint32(exif[4:8], 8)                    // first ifd offset
+	binary.BigEndian.PutUint16(exif[8:10], 1)                   // entry count
+	binary.BigEndian.PutUint16(exif[10:12], exifOrientationTag) // tag
+	binary.BigEndian.PutUint16(exif[12:14], 3)                  // short
+	binary.BigEndian.PutUint32(exif[14:18], 1)                  // value count
+	binary.BigEndian.PutUint16(exif[18:20], orientation)
+	// value padding and next ifd offset are zero
+	return exif
+}
+
+func readExifOrientation(tiff []byte) (uint16, error) {
+	if len(tiff) < 8 {
+		return 0, ErrMalformed
+	}
+	var order binary.ByteOrder
+	switch string(tiff[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, ErrMalformed
+	}
+	if order.Uint16(tiff[2:4]) != 42 {
+		return 0, ErrMalformed
+	}
+	offset := uint64(order.Uint32(tiff[4:8]))
+	if offset+2 > uint64(len(tiff)) {
+		return 0, ErrMalformed
+	}
+	count := uint64(order.Uint16(tiff[offset : offset+2]))
+	entries := tiff[offset+2:]
+	if count*12 > uint64(len(entries)) {
+		return 0, ErrMalformed
+	}
+	for i := uint64(0); i < count; i++ {
+		entry := entries[i*12 : i*12+12]
+		if order.Uint16(entry[0:2]) == exifOrientationTag && order.Uint16(entry[2:4]) == 3 {
+			return order.Uint16(entry[8:10]), nil
+		}
+	}
+	return 0, errors.New("exif has no orientation")
+}
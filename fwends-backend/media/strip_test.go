@@ -0,0 +1,199 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestStripJPEGMetadata(t *testing.T) {
+	var encoded bytes.Buffer
+	err := jpeg.Encode(&encoded, testImage(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := encoded.Bytes()
+
+	// insert exif with an orientation, xmp and a comment after the start of image
+	var b bytes.Buffer
+	b.Write(original[:2])
+	writeJPEGSegment(&b, jpegAPP1, append([]byte("Exif\x00\x00"), testExif(6)...))
+	writeJPEGSegment(&b, jpegAPP1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>"))
+	writeJPEGSegment(&b, jpegCOM, []byte("a comment"))
+	b.Write(original[2:])
+
+	stripped, err := StripMetadata("image/jpeg", b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stripped, []byte("xmpmeta")) || bytes.Contains(stripped, []byte("a comment")) {
+		t.Fatal("metadata was not stripped")
+	}
+	if !bytes.Contains(stripped, []byte("Exif\x00\x00")) {
+		t.Fatal("orientation was not kept")
+	}
+	if len(stripped) != len(original)+4+6+26 {
+		t.Fatalf("stripped to %d bytes, expected %d", len(stripped), len(original)+4+6+26)
+	}
+	_, err = jpeg.Decode(bytes.NewReader(stripped))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// images without metadata are unchanged
+	stripped, err = StripMetadata("image/jpeg", original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stripped, original) {
+		t.Fatal("image without metadata was changed")
+	}
+}
+
+func TestStripPNGMetadata(t *testing.T) {
+	var encoded bytes.Buffer
+	err := png.Encode(&encoded, testImage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := encoded.Bytes()
+
+	// insert text and exif without an orientation after the header
+	ihdrEnd := len(pngSignature) + 12 + 13
+	var b bytes.Buffer
+	b.Write(original[:ihdrEnd])
+	writePNGChunk(&b, "tEXt", []byte("Comment\x00a comment"))
+	writePNGChunk(&b, "eXIf", testExif(1))
+	b.Write(original[ihdrEnd:])
+
+	stripped, err := StripMetadata("image/png", b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stripped, original) {
+		t.Fatal("metadata was not stripped")
+	}
+	_, err = png.Decode(bytes.NewReader(stripped))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStripWebPMetadata(t *testing.T) {
+	vp8x := make([]byte, 10)
+	vp8x[0] = webpFlagExif | webpFlagXMP
+	vp8l := []byte{0x2f, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00} // odd sized, so padded
+	b := testWebP(
+		webpChunk("VP8X", vp8x),
+		webpChunk("VP8L", vp8l),
+		webpChunk("EXIF", testExif(3)),
+		webpChunk("XMP ", []byte("<x:xmpmeta/>")),
+	)
+
+	stripped, err := StripMetadata("image/webp", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedVP8X := make([]byte, 10)
+	expectedVP8X[0] = webpFlagExif
+	expected := testWebP(
+		webpChunk("VP8X", expectedVP8X),
+		webpChunk("VP8L", vp8l),
+		webpChunk("EXIF", minimalExif(testExif(3))),
+	)
+	if !bytes.Equal(stripped, expected) {
+		t.Fatalf("stripped to %x, expected %x", stripped, expected)
+	}
+}
+
+func TestStripMalformed(t *testing.T) {
+	tests := []struct {
+		name      string
+		mediaType string
+		data      []byte
+	}{
+		{"webp_small_riff_size", "image/webp", append([]byte("RIFF\x00\x00\x00\x00WEBP"), make([]byte, 100)...)},
+		{"webp_riff_size_3", "image/webp", append([]byte("RIFF\x03\x00\x00\x00WEBP"), make([]byte, 100)...)},
+		{"webp_truncated_chunk", "image/webp", testWebP([]byte("VP8L\xff\x00\x00\x00"))},
+		{"webp_empty_vp8x", "image/webp", testWebP(webpChunk("VP8X", nil))},
+		{"jpeg_truncated", "image/jpeg", []byte("\xff\xd8\xff\xe1\x00\x10Exif")},
+		{"jpeg_no_soi", "image/jpeg", []byte("not a jpeg")},
+		{"png_truncated_chunk", "image/png", append(append([]byte{}, pngSignature...), "\x00\x00\x00\xffIDAT"...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := StripMetadata(tt.mediaType, tt.data)
+			if err != ErrMalformed {
+				t.Fatalf("expected ErrMalformed, got %v", err)
+			}
+		})
+	}
+}
+
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 16), uint8(y * 16), 128, 255})
+		}
+	}
+	return img
+}
+
+// a big endian tiff block with an orientation and another tag
+func testExif(orientation uint16) []byte {
+	exif := make([]byte, 38)
+	copy(exif[0:4], "MM\x00\x2A")
+	binary.BigEndian.PutUint32(exif[4:8], 8)
+	binary.BigEndian.PutUint16(exif[8:10], 2)
+	binary.BigEndian.PutUint16(exif[10:12], 0x010F) // make
+	binary.BigEndian.PutUint16(exif[12:14], 2)
+	binary.BigEndian.PutUint32(exif[14:18], 4)
+	copy(exif[18:22], "ACME")
+	binary.BigEndian.PutUint16(exif[22:24], exifOrientationTag)
+	binary.BigEndian.PutUint16(exif[24:26], 3)
+	binary.BigEndian.PutUint32(exif[26:30], 1)
+	binary.BigEndian.PutUint16(exif[30:32], orientation)
+	return exif
+}
+
+func writeJPEGSegment(b *bytes.Buffer, marker byte, payload []byte) {
+	b.Write([]byte{0xFF, marker})
+	binary.Write(b, binary.BigEndian, uint16(2+len(payload)))
+	b.Write(payload)
+}
+
+func writePNGChunk(b *bytes.Buffer, chunkType string, payload []byte) {
+	binary.Write(b, binary.BigEndian, uint32(len(payload)))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(chunkType))
+	crc.Write(payload)
+	b.WriteString(chunkType)
+	b.Write(payload)
+	binary.Write(b, binary.BigEndian, crc.Sum32())
+}
+
+func webpChunk(fourCC string, payload []byte) []byte {
+	chunk := []byte(fourCC)
+	chunk = append(chunk, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(chunk[4:8], uint32(len(payload)))
+	chunk = append(chunk, payload...)
+	if len(payload)&1 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func testWebP(chunks ...[]byte) []byte {
+	b := []byte("RIFF\x00\x00\x00\x00WEBP")
+	for _, chunk := range chunks {
+		b = append(b, chunk...)
+	}
+	binary.LittleEndian.PutUint32(b[4:8], uint32(len(b)-8))
+	return b
+}
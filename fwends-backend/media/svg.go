@@ -0,0 +1,227 @@
+package media
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// elements that can run scripts or embed other documents, they are removed with their children
+var svgActiveElements = map[string]bool{
+	"script":        true,
+	"foreignobject": true,
+	"iframe":        true,
+	"embed":         true,
+	"object":        true,
+	"handler":       true,
+	"listener":      true,
+}
+
+// elements that can change the attributes of others, such as setting a javascript href
+var svgAnimationElements = map[string]bool{
+	"set":              true,
+	"animate":          true,
+	"animatecolor":     true,
+	"animatemotion":    true,
+	"animatetransform": true,
+}
+
+// references that stay within the document, or embed an inert raster image
+var svgSafeReference = regexp.MustCompile(`^(#|data:image/(png|jpeg|gif|webp);)`)
+
+// references in css that would fetch something, or run something in old browsers
+var cssExternalReference = regexp.MustCompile(`(?i)@import|expression\s*\(|javascript:|url\(\s*['"]?\s*[^'"#\s)]`)
+
+// SanitizeSVG removes scripts, event handlers, external references and embedded
+// documents from an svg. It returns the sanitized svg along with a description of
+// each kind of content that was removed.
+func SanitizeSVG(r io.Reader) ([]byte, []string, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = true
+	var out bytes.Buffer
+	var removed []string
+	removedSeen := make(map[string]bool)
+	remove := func(format string, args ...interface{}) {
+		description := fmt.Sprintf(format, args...)
+		if !removedSeen[description] {
+			removedSeen[description] = true
+			removed = append(removed, description)
+		}
+	}
+
+	var open []xml.Name // raw tokens do not check that elements are balanced
+	skipDepth := 0      // depth of the element being removed, or zero
+	inStyle := false
+	foundRoot := false
+	for {
+		// raw tokens keep namespace prefixes as written
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse svg: %v", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if len(open) == 0 && foundRoot {
+				return nil, nil, errors.New("svg has more than one root element")
+			}
+			open = append(open, t.Name)
+			depth := len(open)
+			if skipDepth != 0 {
+				continue
+			}
+			name := strings.ToLower(t.Name.Local)
+			if depth == 1 {
+				if name != "svg" {
+					return nil, nil, errors.New("svg root element is not svg")
+				}
+				foundRoot = true
+			}
+			if svgActiveElements[name] {
+				remove("element %v", name)
+				skipDepth = depth
+				continue
+			}
+			if svgAnimationElements[name] && isUnsafeSVGAnimation(t) {
+				remove("element %v", name)
+				skipDepth = depth
+				continue
+			}
+			attrs := make([]xml.Attr, 0, len(t.Attr))
+			for _, attr := range t.Attr {
+				attrName := strings.ToLower(attr.Name.Local)
+				switch {
+				case strings.HasPrefix(attrName, "on"):
+					remove("attribute %v", attrName)
+				case attrName == "href" || attrName == "src":
+					if svgSafeReference.MatchString(strings.TrimSpace(attr.Value)) {
+						attrs = append(attrs, attr)
+					} else {
+						remove("attribute %v", attrName)
+					}
+				case attrName == "base" && attr.Name.Space == "xml":
+					remove("attribute xml:base")
+				case attrName == "style" && cssExternalReference.MatchString(attr.Value):
+					remove("attribute style")
+				default:
+					attrs = append(attrs, attr)
+				}
+			}
+			t.Attr = attrs
+			inStyle = name == "style"
+			if inStyle {
+				// style content is checked as a whole when the element ends
+				var style bytes.Buffer
+				writeSVGStartElement(&style, t)
+				for inStyle {
+					token, err := decoder.RawToken()
+					if err != nil {
+						return nil, nil, fmt.Errorf("failed to parse svg: %v", err)
+					}
+					switch t := token.(type) {
+					case xml.CharData:
+						xml.EscapeText(&style, t)
+					case xml.StartElement:
+						return nil, nil, errors.New("svg style element contains elements")
+					case xml.EndElement:
+						if t.Name != open[len(open)-1] {
+							return nil, nil, errors.New("svg has mismatched end element")
+						}
+						open = open[:len(open)-1]
+						writeSVGEndElement(&style, t)
+						inStyle = false
+					}
+				}
+				if cssExternalReference.Match(style.Bytes()) {
+					remove("element style")
+				} else {
+					out.Write(style.Bytes())
+				}
+				continue
+			}
+			writeSVGStartElement(&out, t)
+		case xml.EndElement:
+			if len(open) == 0 || t.Name != open[len(open)-1] {
+				return nil, nil, errors.New("svg has mismatched end element")
+			}
+			open = open[:len(open)-1]
+			if skipDepth != 0 {
+				if len(open) < skipDepth {
+					skipDepth = 0
+				}
+				continue
+			}
+			writeSVGEndElement(&out, t)
+		case xml.CharData:
+			if skipDepth == 0 {
+				xml.EscapeText(&out, t)
+			}
+		case xml.Comment:
+			// comments are inert, but are dropped rather than escaped
+		case xml.ProcInst:
+			if t.Target == "xml" {
+				out.WriteString("<?xml")
+				if len(t.Inst) > 0 {
+					out.WriteString(" ")
+					out.Write(t.Inst)
+				}
+				out.WriteString("?>")
+			} else {
+				remove("processing instruction %v", t.Target)
+			}
+		case xml.Directive:
+			// doctypes can declare entities and reference external dtds
+			remove("doctype")
+		}
+	}
+	if !foundRoot || len(open) != 0 {
+		return nil, nil, errors.New("svg is incomplete")
+	}
+	return out.Bytes(), removed, nil
+}
+
+func isUnsafeSVGAnimation(t xml.StartElement) bool {
+	for _, attr := range t.Attr {
+		name := strings.ToLower(attr.Name.Local)
+		value := strings.ToLower(strings.TrimSpace(attr.Value))
+		if name == "attributename" && (value == "href" || value == "xlink:href" || strings.HasPrefix(value, "on")) {
+			return true
+		}
+		if (name == "to" || name == "from" || name == "values" || name == "by") && strings.Contains(value, "javascript:") {
+			return true
+		}
+	}
+	return false
+}
+
+func writeSVGStartElement(w *bytes.Buffer, t xml.StartElement) {
+	w.WriteString("<")
+	writeSVGName(w, t.Name)
+	for _, attr := range t.Attr {
+		w.WriteString(" ")
+		writeSVGName(w, attr.Name)
+		w.WriteString(`="`)
+		xml.EscapeText(w, []byte(attr.Value))
+		w.WriteString(`"`)
+	}
+	w.WriteString(">")
+}
+
+func writeSVGEndElement(w *bytes.Buffer, t xml.EndElement) {
+	w.WriteString("</")
+	writeSVGName(w, t.Name)
+	w.WriteString(">")
+}
+
+func writeSVGName(w *bytes.Buffer, name xml.Name) {
+	if name.Space != "" {
+		w.WriteString(name.Space)
+		w.WriteString(":")
+	}
+	w.WriteString(name.Local)
+}
@@ -0,0 +1,209 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"sort"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// Variant is a resized copy of an image.
+type Variant struct {
+	Width       int
+	Height      int
+	ContentType string
+	Data        []byte
+}
+
+// images are decoded fully into memory, so larger images do not get variants
+const maxVariantSourcePixels = 50 * 1000 * 1000
+
+const variantJPEGQuality = 82
+
+// ErrTooManyPixels is returned for images that are too large to resize.
+var ErrTooManyPixels = errors.New("image has too many pixels to resize")
+
+// GenerateVariants resizes a jpeg, png, gif or webp image so that its longest
+// side fits each of the given sizes, returning the variants smallest first. Sizes
+// that are not smaller than the image are skipped. Variants are encoded as jpeg,
+// or as png if the image has transparency. The exif orientation of jpegs is
+// applied to the variants, as they do not carry any metadata.
+func GenerateVariants(mediaType string, b []byte, sizes []int) ([]Variant, error) {
+	src, orientation, err := decodeImage(mediaType, b)
+	if err != nil {
+		return nil, err
+	}
+
+	opaque := isOpaque(src)
+	bounds := src.Bounds()
+	longest := bounds.Dx()
+	if bounds.Dy() > longest {
+		longest = bounds.Dy()
+	}
+
+	// each variant is scaled down from the next largest, which is much quicker
+	// than scaling them all from the original
+	sizes = append([]int(nil), sizes...)
+	sort.Sort(sort.Reverse(sort.IntSlice(sizes)))
+	var variants []Variant
+	for _, size := range sizes {
+		if size >= longest {
+			continue
+		}
+		// scale the longest side to the size, keeping the aspect ratio
+		width := (bounds.Dx()*size + longest/2) / longest
+		height := (bounds.Dy()*size + longest/2) / longest
+		if width < 1 {
+			width = 1
+		}
+		if height < 1 {
+			height = 1
+		}
+		dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+		xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+		src = dst
+
+		oriented := applyOrientation(dst, orientation)
+
+		var buf bytes.Buffer
+		variant := Variant{Width: oriented.Bounds().Dx(), Height: oriented.Bounds().Dy()}
+		if opaque {
+			variant.ContentType = "image/jpeg"
+			err = jpeg.Encode(&buf, oriented, &jpeg.Options{Quality: variantJPEGQuality})
+		} else {
+			variant.ContentType = "image/png"
+			err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, oriented)
+		}
+		if err != nil {
+			return nil, err
+		}
+		variant.Data = buf.Bytes()
+		variants = append(variants, variant)
+	}
+
+	// smallest first
+	for i, j := 0, len(variants)-1; i < j; i, j = i+1, j-1 {
+		variants[i], variants[j] = variants[j], variants[i]
+	}
+	return variants, nil
+}
+
+// decodes a jpeg, png, gif or webp image, returning the exif orientation of jpegs
+func decodeImage(mediaType string, b []byte) (image.Image, uint16, error) {
+	var decode func([]byte) (image.Image, error)
+	var decodeConfig func([]byte) (image.Config, error)
+	switch mediaType {
+	case "image/jpeg":
+		decode = func(b []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(b)) }
+		decodeConfig = func(b []byte) (image.Config, error) { return jpeg.DecodeConfig(bytes.NewReader(b)) }
+	case "image/png":
+		decode = func(b []byte) (image.Image, error) { return png.Decode(bytes.NewReader(b)) }
+		decodeConfig = func(b []byte) (image.Config, error) { return png.DecodeConfig(bytes.NewReader(b)) }
+	case "image/gif":
+		// only the first frame of animations
+		decode = func(b []byte) (image.Image, error) { return gif.Decode(bytes.NewReader(b)) }
+		decodeConfig = func(b []byte) (image.Config, error) { return gif.DecodeConfig(bytes.NewReader(b)) }
+	case "image/webp":
+		decode = func(b []byte) (image.Image, error) { return webp.Decode(bytes.NewReader(b)) }
+		decodeConfig = func(b []byte) (image.Config, error) { return webp.DecodeConfig(bytes.NewReader(b)) }
+	default:
+		return nil, 0, ErrUnsupported
+	}
+
+	// check the dimensions before allocating the pixels
+	config, err := decodeConfig(b)
+	if err != nil {
+		return nil, 0, ErrMalformed
+	} else if config.Width*config.Height > maxVariantSourcePixels {
+		return nil, 0, ErrTooManyPixels
+	}
+	img, err := decode(b)
+	if err != nil {
+		return nil, 0, ErrMalformed
+	}
+	var orientation uint16
+	if mediaType == "image/jpeg" {
+		orientation = readJPEGOrientation(b)
+	}
+	return img, orientation, nil
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// rotates and flips an image as described by an exif orientation
+func applyOrientation(img *image.NRGBA, orientation uint16) *image.NRGBA {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	var dst *image.NRGBA
+	if orientation >= 5 {
+		// orientations 5 to 8 transpose the image
+		dst = image.NewNRGBA(image.Rect(0, 0, h, w))
+	} else {
+		dst = image.NewNRGBA(image.Rect(0, 0, w, h))
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.SetNRGBA(dx, dy, img.NRGBAAt(x, y))
+		}
+	}
+	return dst
+}
+
+// finds the exif orientation in the segments before the start of scan
+func readJPEGOrientation(b []byte) uint16 {
+	if len(b) < 2 {
+		return 0
+	}
+	b = b[2:]
+	for len(b) >= 4 && b[0] == 0xFF {
+		marker := b[1]
+		if marker == jpegSOS {
+			break
+		}
+		size := 2 + int(binary.BigEndian.Uint16(b[2:4]))
+		if size < 4 || size > len(b) {
+			break
+		}
+		payload := b[4:size]
+		if marker == jpegAPP1 && bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+			orientation, err := readExifOrientation(payload[6:])
+			if err == nil {
+				return orientation
+			}
+		}
+		b = b[size:]
+	}
+	return 0
+}
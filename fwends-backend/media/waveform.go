@@ -0,0 +1,51 @@
+package media
+
+import "math"
+
+// peaks are first taken over short windows, as the length of a stream is not
+// known upfront, then merged down to the number of peaks wanted
+const waveformWindowsPerSecond = 100
+
+type waveformBuilder struct {
+	windowLength int
+	windowPeak   float64
+	windowFrames int
+	windows      []float64
+}
+
+func (w *waveformBuilder) start(sampleRate int, channels int) {
+	w.windowLength = sampleRate / waveformWindowsPerSecond
+	if w.windowLength < 1 {
+		w.windowLength = 1
+	}
+}
+
+func (w *waveformBuilder) add(frame []float64) {
+	for _, sample := range frame {
+		w.windowPeak = math.Max(w.windowPeak, math.Abs(sample))
+	}
+	w.windowFrames++
+	if w.windowFrames == w.windowLength {
+		w.windows = append(w.windows, w.windowPeak)
+		w.windowPeak = 0
+		w.windowFrames = 0
+	}
+}
+
+func (w *waveformBuilder) peaks(count int) []float64 {
+	windows := w.windows
+	if w.windowFrames > 0 {
+		windows = append(windows, w.windowPeak)
+	}
+	if len(windows) <= count {
+		count = len(windows)
+	}
+	peaks := make([]float64, count)
+	for i, window := range windows {
+		bucket := i * count / len(windows)
+		if window > peaks[bucket] {
+			peaks[bucket] = math.Min(window, 1)
+		}
+	}
+	return peaks
+}
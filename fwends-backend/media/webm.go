@@ -0,0 +1,236 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"time"
+)
+
+// see https://www.matroska.org/technical/elements.html
+
+const (
+	ebmlHeaderID     = 0x1A45DFA3
+	ebmlSegmentID    = 0x18538067
+	ebmlClusterID    = 0x1F43B675
+	ebmlInfoID       = 0x1549A966
+	ebmlTimescaleID  = 0x2AD7B1
+	ebmlDurationID   = 0x4489
+	ebmlTracksID     = 0x1654AE6B
+	ebmlTrackEntryID = 0xAE
+	ebmlVideoID      = 0xE0
+	ebmlPixelWidthID = 0xB0
+	ebmlPixelHeight  = 0xBA
+)
+
+// the info and tracks elements are buffered in memory, they are tiny in practice
+const maxEBMLElementSize = 1024 * 1024
+
+// size of an element whose size is not known upfront, such as a live stream segment
+const ebmlUnknownSize = -1
+
+// reads the segment until its info and tracks are found, they precede any clusters
+func probeWebM(r io.Reader) (Metadata, error) {
+	br := bufio.NewReader(r)
+
+	// skip the ebml header
+	id, size, err := readEBMLElementHeader(br)
+	if err != nil {
+		return Metadata{}, err
+	} else if id != ebmlHeaderID || size == ebmlUnknownSize {
+		return Metadata{}, ErrMalformed
+	}
+	_, err = io.CopyN(io.Discard, br, size)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	// enter the segment, its size does not matter as only its start is read
+	id, _, err = readEBMLElementHeader(br)
+	if err != nil {
+		return Metadata{}, err
+	} else if id != ebmlSegmentID {
+		return Metadata{}, ErrMalformed
+	}
+
+	var meta Metadata
+	var foundInfo, foundTracks bool
+	for !foundInfo || !foundTracks {
+		id, size, err := readEBMLElementHeader(br)
+		if err == io.EOF || id == ebmlClusterID {
+			break
+		} else if err != nil {
+			return Metadata{}, err
+		} else if size == ebmlUnknownSize {
+			return Metadata{}, ErrMalformed
+		}
+		if id != ebmlInfoID && id != ebmlTracksID {
+			_, err := io.CopyN(io.Discard, br, size)
+			if err != nil {
+				return Metadata{}, err
+			}
+			continue
+		}
+		if size > maxEBMLElementSize {
+			return Metadata{}, errors.New("webm element is too large")
+		}
+		payload := make([]byte, size)
+		_, err = io.ReadFull(br, payload)
+		if err != nil {
+			return Metadata{}, err
+		}
+		if id == ebmlInfoID {
+			meta.Duration, err = parseWebMInfo(payload)
+			foundInfo = true
+		} else {
+			meta.Width, meta.Height, err = parseWebMTracks(payload)
+			foundTracks = true
+		}
+		if err != nil {
+			return Metadata{}, err
+		}
+	}
+	if !foundInfo {
+		return Metadata{}, errors.New("webm has no segment info")
+	}
+	return meta, nil
+}
+
+func parseWebMInfo(b []byte) (time.Duration, error) {
+	timescale := uint64(1000000) // nanoseconds per tick, default is a millisecond
+	var duration float64
+	err := forEachEBMLElement(b, func(id uint32, payload []byte) error {
+		var err error
+		switch id {
+		case ebmlTimescaleID:
+			timescale, err = parseEBMLUint(payload)
+		case ebmlDurationID:
+			duration, err = parseEBMLFloat(payload)
+		}
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(duration * float64(timescale)), nil
+}
+
+func parseWebMTracks(b []byte) (int, int, error) {
+	var width, height uint64
+	err := forEachEBMLElement(b, func(id uint32, payload []byte) error {
+		// the first track with dimensions is taken to be the video track
+		if id != ebmlTrackEntryID || width != 0 {
+			return nil
+		}
+		return forEachEBMLElement(payload, func(id uint32, payload []byte) error {
+			if id != ebmlVideoID {
+				return nil
+			}
+			return forEachEBMLElement(payload, func(id uint32, payload []byte) error {
+				var err error
+				switch id {
+				case ebmlPixelWidthID:
+					width, err = parseEBMLUint(payload)
+				case ebmlPixelHeight:
+					height, err = parseEBMLUint(payload)
+				}
+				return err
+			})
+		})
+	})
+	if width > math.MaxInt32 || height > math.MaxInt32 {
+		return 0, 0, ErrMalformed
+	}
+	return int(width), int(height), err
+}
+
+func forEachEBMLElement(b []byte, fn func(id uint32, payload []byte) error) error {
+	r := bytes.NewReader(b)
+	for r.Len() > 0 {
+		id, size, err := readEBMLElementHeader(r)
+		if err != nil {
+			return ErrMalformed
+		} else if size == ebmlUnknownSize || size > int64(r.Len()) {
+			return ErrMalformed
+		}
+		offset := len(b) - r.Len()
+		err = fn(id, b[offset:offset+int(size)])
+		if err != nil {
+			return err
+		}
+		_, _ = r.Seek(size, io.SeekCurrent)
+	}
+	return nil
+}
+
+// reads an element id, which keeps its length marker, and its size, which does not
+func readEBMLElementHeader(r io.ByteReader) (uint32, int64, error) {
+	id, length, err := readEBMLVint(r, 4)
+	if err != nil {
+		return 0, 0, err
+	}
+	id |= 1 << (7 * length)
+	size, length, err := readEBMLVint(r, 8)
+	if err == io.EOF {
+		return 0, 0, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return 0, 0, err
+	}
+	if size == 1<<(7*length)-1 {
+		return uint32(id), ebmlUnknownSize, nil
+	}
+	return uint32(id), int64(size), nil
+}
+
+// reads a variable length integer without its length marker, returning the length in bytes
+func readEBMLVint(r io.ByteReader, maxLength int) (uint64, int, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	length := 1
+	for mask := byte(0x80); first&mask == 0; mask >>= 1 {
+		length++
+		if mask == 1 || length > maxLength {
+			return 0, 0, ErrMalformed
+		}
+	}
+	value := uint64(first & (0xFF >> length))
+	for i := 1; i < length; i++ {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			return 0, 0, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return 0, 0, err
+		}
+		value = value<<8 | uint64(b)
+	}
+	return value, length, nil
+}
+
+func parseEBMLUint(b []byte) (uint64, error) {
+	if len(b) > 8 {
+		return 0, ErrMalformed
+	}
+	var value uint64
+	for _, c := range b {
+		value = value<<8 | uint64(c)
+	}
+	return value, nil
+}
+
+func parseEBMLFloat(b []byte) (float64, error) {
+	switch len(b) {
+	case 0:
+		return 0, nil
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	default:
+		return 0, ErrMalformed
+	}
+}
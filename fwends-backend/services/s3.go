@@ -39,3 +39,25 @@ func NewS3(cfg *config.S3Config) (*s3.Client, error) {
 	return s3.NewFromConfig(awscfg), nil
 
 }
+
+// NewS3Presigner returns a client that presigns requests for the public endpoint,
+// as clients may not be able to reach s3 by the same endpoint as the backend
+func NewS3Presigner(cfg *config.S3Config, s3c *s3.Client) *s3.PresignClient {
+	endpoint := cfg.PublicEndpoint
+	if endpoint == "" {
+		endpoint = cfg.Endpoint
+	}
+	publicResolver := s3.EndpointResolverFunc(
+		func(region string, options s3.EndpointResolverOptions) (aws.Endpoint, error) {
+			return aws.Endpoint{
+				PartitionID:       "aws",
+				URL:               endpoint,
+				SigningRegion:     cfg.Region,
+				HostnameImmutable: true,
+			}, nil
+		},
+	)
+	return s3.NewPresignClient(s3c, s3.WithPresignClientFromClientOptions(func(o *s3.Options) {
+		o.EndpointResolver = publicResolver
+	}))
+}
@@ -0,0 +1,39 @@
+package util
+
+import (
+	"errors"
+	"io"
+)
+
+var ErrLimitExceeded = errors.New("read limit exceeded")
+
+// LimitedReader is like io.LimitedReader, but fails rather than stopping short,
+// so that a truncated stream is never mistaken for a complete one.
+type LimitedReader struct {
+	r        io.Reader
+	limit    int64
+	read     int64
+	exceeded bool
+}
+
+func NewLimitedReader(r io.Reader, limit int64) *LimitedReader {
+	return &LimitedReader{r: r, limit: limit}
+}
+
+func (l *LimitedReader) Read(p []byte) (int, error) {
+	if l.exceeded {
+		return 0, ErrLimitExceeded
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.limit {
+		l.exceeded = true
+		return n, ErrLimitExceeded
+	}
+	return n, err
+}
+
+// Exceeded reports whether more than the limit was read.
+func (l *LimitedReader) Exceeded() bool {
+	return l.exceeded
+}
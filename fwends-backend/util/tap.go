@@ -0,0 +1,47 @@
+package util
+
+import (
+	"fmt"
+	"io"
+)
+
+// Tap mirrors a stream to a concurrent consumer, such as a parser, as it is read.
+// The stream is never buffered, the consumer sees each chunk as it passes through.
+type Tap struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+// NewTap returns a reader that mirrors r to consume, which runs in its own goroutine.
+// Whatever the consumer does not read is discarded, so it can never block the stream,
+// and if it panics the stream fails with the panic as its error.
+func NewTap(r io.Reader, consume func(io.Reader) error) (io.Reader, *Tap) {
+	pr, pw := io.Pipe()
+	t := &Tap{pw, make(chan error, 1)}
+	go func() {
+		var err error
+		defer func() {
+			// a panic here would take down the whole process, so it fails the stream
+			// instead, as nothing is left to read what is written to the pipe
+			if p := recover(); p != nil {
+				err = fmt.Errorf("tap consumer panicked: %v", p)
+				pr.CloseWithError(err)
+			}
+			t.done <- err
+		}()
+		err = consume(pr)
+		_, _ = io.Copy(io.Discard, pr)
+	}()
+	return io.TeeReader(r, pw), t
+}
+
+// Close signals the end of the stream, or that reading it failed with err, then
+// waits for the consumer and returns its error.
+func (t *Tap) Close(err error) error {
+	if err != nil {
+		t.pw.CloseWithError(err)
+	} else {
+		t.pw.Close()
+	}
+	return <-t.done
+}
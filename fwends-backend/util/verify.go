@@ -0,0 +1,75 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"hash"
+	"io"
+)
+
+var ErrDigestMismatch = errors.New("digest mismatch")
+
+// Digest is a hash of a stream, and the sum it is expected to have. Digests with
+// no expected sum are computed but not checked.
+type Digest struct {
+	Hash     hash.Hash
+	Expected []byte
+}
+
+// VerifyingReader hashes a stream as it is read, and fails at its end if any of
+// the digests do not match. The end is either EOF or the expected length, as
+// consumers such as http clients stop reading once they have that many bytes.
+type VerifyingReader struct {
+	r          io.Reader
+	length     int64
+	read       int64
+	digests    []Digest
+	verified   bool
+	mismatched bool
+}
+
+// NewVerifyingReader returns a reader that verifies digests of r, which has the
+// given length, or a negative length if it is not known.
+func NewVerifyingReader(r io.Reader, length int64, digests []Digest) *VerifyingReader {
+	return &VerifyingReader{r: r, length: length, digests: digests}
+}
+
+func (v *VerifyingReader) Read(p []byte) (int, error) {
+	if v.mismatched {
+		return 0, ErrDigestMismatch
+	}
+	n, err := v.r.Read(p)
+	for _, digest := range v.digests {
+		digest.Hash.Write(p[:n])
+	}
+	v.read += int64(n)
+	if err == io.EOF || (v.length >= 0 && v.read == v.length) {
+		// the last bytes are held back on a mismatch, so that nothing downstream
+		// can mistake the stream for a complete one
+		if v.Verify() != nil {
+			return 0, ErrDigestMismatch
+		}
+	}
+	return n, err
+}
+
+// Verify checks the digests against what has been read so far, which is normally
+// done at the end of the stream. It can be called again after the end, to check
+// that the whole stream was read.
+func (v *VerifyingReader) Verify() error {
+	v.verified = true
+	for _, digest := range v.digests {
+		if digest.Expected != nil && !bytes.Equal(digest.Hash.Sum(nil), digest.Expected) {
+			v.mismatched = true
+		}
+	}
+	if v.mismatched {
+		return ErrDigestMismatch
+	}
+	return nil
+}
+
+// Mismatched reports whether any digest did not match.
+func (v *VerifyingReader) Mismatched() bool {
+	return v.mismatched
+}
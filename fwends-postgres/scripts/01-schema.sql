@@ -2,13 +2,6 @@ CREATE TABLE admins (
 	email varchar(255) PRIMARY KEY
 );
 
-CREATE TABLE packs (
-	pack_id bigint PRIMARY KEY,
-	title varchar(255) NOT NULL,
-	hash bytea NOT NULL DEFAULT '\xe3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855'
-);
-CREATE INDEX packs_hash_idx ON packs(hash);
-
 CREATE TABLE pieces (
 	hash bytea NOT NULL,
 	seed bytea NOT NULL,
@@ -17,14 +10,86 @@ CREATE TABLE pieces (
 );
 
 CREATE TABLE resources (
-	resource_id bigint PRIMARY KEY
+	resource_id bigint PRIMARY KEY,
+	width integer,
+	height integer,
+	duration_ms bigint,
+	sample_rate integer,
+	channels smallint,
+	size bigint,
+	sha256 bytea,
+	loudness_lufs real,
+	peak_dbfs real,
+	blurhash varchar(255),
+	content_type varchar(255),
+	ref_count integer NOT NULL DEFAULT 0
 );
+CREATE INDEX resources_sha256_idx ON resources(sha256);
 
 CREATE TABLE pruned_resources (
 	resource_id bigint PRIMARY KEY
 );
 
-CREATE TYPE resourceclass AS ENUM ('image', 'audio');
+CREATE TABLE resource_variants (
+	resource_id bigint NOT NULL,
+	variant_resource_id bigint PRIMARY KEY,
+	width integer NOT NULL,
+	height integer NOT NULL,
+	FOREIGN KEY (resource_id) REFERENCES resources(resource_id)
+		ON DELETE NO ACTION
+		ON UPDATE NO ACTION,
+	FOREIGN KEY (variant_resource_id) REFERENCES resources(resource_id)
+		ON DELETE NO ACTION
+		ON UPDATE NO ACTION
+);
+CREATE INDEX resource_variants_resource_id_idx ON resource_variants(resource_id);
+
+CREATE TABLE resource_waveforms (
+	resource_id bigint PRIMARY KEY,
+	peaks bytea NOT NULL,
+	FOREIGN KEY (resource_id) REFERENCES resources(resource_id)
+		ON DELETE NO ACTION
+		ON UPDATE NO ACTION
+);
+
+CREATE TYPE agerating AS ENUM ('everyone', 'teen', 'mature');
+CREATE TYPE resourceclass AS ENUM ('image', 'audio', 'text', 'video');
+CREATE TYPE packstatus AS ENUM ('draft', 'published', 'archived');
+CREATE TABLE packs (
+	pack_id bigint PRIMARY KEY,
+	title varchar(255) NOT NULL,
+	description varchar(4096) NOT NULL DEFAULT '',
+	tags varchar(63)[] NOT NULL DEFAULT '{}',
+	language varchar(35) NOT NULL DEFAULT 'und',
+	age_rating agerating NOT NULL DEFAULT 'everyone',
+	cover_resource_id bigint,
+	hash bytea NOT NULL DEFAULT '\xe3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855',
+	required_classes resourceclass[] NOT NULL DEFAULT '{image,audio}',
+	status packstatus NOT NULL DEFAULT 'draft',
+	revision integer NOT NULL DEFAULT 1,
+	published_revision integer,
+	FOREIGN KEY (cover_resource_id) REFERENCES resources(resource_id)
+		ON DELETE NO ACTION
+		ON UPDATE NO ACTION
+);
+CREATE INDEX packs_hash_idx ON packs(hash);
+CREATE INDEX packs_tags_idx ON packs USING GIN (tags);
+CREATE INDEX packs_cover_resource_id_idx ON packs(cover_resource_id);
+CREATE INDEX packs_status_idx ON packs(status);
+
+CREATE TABLE published_packs (
+	pack_id bigint PRIMARY KEY,
+	revision integer NOT NULL,
+	pack jsonb NOT NULL,
+	resource_ids bigint[] NOT NULL,
+	published_at timestamptz NOT NULL DEFAULT now(),
+	FOREIGN KEY (pack_id) REFERENCES packs(pack_id)
+		ON DELETE NO ACTION
+		ON UPDATE NO ACTION
+);
+
+CREATE INDEX published_packs_resource_ids_idx ON published_packs USING GIN (resource_ids);
+
 CREATE TABLE pack_resources (
 	pack_id bigint NOT NULL,
 	role_id varchar(63) NOT NULL,
@@ -40,3 +105,47 @@ CREATE TABLE pack_resources (
 	PRIMARY KEY (pack_id, role_id, string_id, resource_class)
 );
 CREATE INDEX pack_resources_resource_id_idx ON pack_resources(resource_id);
+
+CREATE TABLE pack_roles (
+	pack_id bigint NOT NULL,
+	role_id varchar(63) NOT NULL,
+	label varchar(255) NOT NULL DEFAULT '',
+	position integer NOT NULL DEFAULT 0,
+	FOREIGN KEY (pack_id) REFERENCES packs(pack_id)
+		ON DELETE NO ACTION
+		ON UPDATE NO ACTION,
+	PRIMARY KEY (pack_id, role_id)
+);
+
+CREATE TABLE pack_strings (
+	pack_id bigint NOT NULL,
+	role_id varchar(63) NOT NULL,
+	string_id varchar(63) NOT NULL,
+	label varchar(255) NOT NULL DEFAULT '',
+	position integer NOT NULL DEFAULT 0,
+	FOREIGN KEY (pack_id) REFERENCES packs(pack_id)
+		ON DELETE NO ACTION
+		ON UPDATE NO ACTION,
+	PRIMARY KEY (pack_id, role_id, string_id)
+);
+
+CREATE TABLE upload_sessions (
+	upload_id bigint PRIMARY KEY,
+	resource_id bigint NOT NULL,
+	pack_id bigint NOT NULL,
+	role_id varchar(63) NOT NULL,
+	string_id varchar(63) NOT NULL,
+	resource_class resourceclass NOT NULL,
+	content_type varchar(255) NOT NULL,
+	size bigint NOT NULL,
+	received bigint NOT NULL DEFAULT 0,
+	presigned boolean NOT NULL DEFAULT false,
+	multipart_upload_id varchar(1024),
+	part_etags varchar(255)[] NOT NULL DEFAULT '{}',
+	locked_until timestamptz,
+	expires_at timestamptz NOT NULL,
+	FOREIGN KEY (resource_id) REFERENCES resources(resource_id)
+		ON DELETE NO ACTION
+		ON UPDATE NO ACTION
+);
+CREATE INDEX upload_sessions_expires_at_idx ON upload_sessions(expires_at);
@@ -1,5 +1,11 @@
+import io
+import math
+import time
+import base64
+import struct
 import hashlib
 import requests
+from util import retry_assert
 
 def test_pack_no_resources(backend):
 	pack_id = create_test_pack(backend, "Test Pack Update")
@@ -88,6 +94,1007 @@ def test_pack_role_and_string_counts(backend, media):
 	response = requests.delete(backend+"/packs/"+pack_id)
 	assert response.status_code == 200
 
+def test_pack_metadata(backend, media):
+	pack = {
+		"title":"Test Pack Metadata",
+		"description":"Birds and mammals",
+		"tags":["Animals", "  kids ", "animals"],
+		"language":"EN-gb",
+		"ageRating":"everyone"
+	}
+	response = requests.post(backend + "/packs/", json=pack)
+	assert response.status_code == 200
+	pack_id = response.json()["id"]
+	verify_pack_metadata(backend, pack_id, {
+		"title":"Test Pack Metadata",
+		"description":"Birds and mammals",
+		"tags":["animals", "kids"],
+		"language":"en-GB",
+		"ageRating":"everyone"
+	})
+
+	# omitted fields are left unchanged
+	response = requests.patch(backend+"/packs/"+pack_id, json={"ageRating":"teen"})
+	assert response.status_code == 200
+	verify_pack_metadata(backend, pack_id, {
+		"title":"Test Pack Metadata",
+		"description":"Birds and mammals",
+		"tags":["animals", "kids"],
+		"language":"en-GB",
+		"ageRating":"teen"
+	})
+
+	response = requests.patch(backend+"/packs/"+pack_id, json={"ageRating":"unknown"})
+	assert response.status_code == 400
+	response = requests.patch(backend+"/packs/"+pack_id, json={"language":"not a language"})
+	assert response.status_code == 400
+
+	# filter by tags
+	verify_pack_listed(backend, pack_id, "?tag=animals", True)
+	verify_pack_listed(backend, pack_id, "?tag=animals&tag=kids", True)
+	verify_pack_listed(backend, pack_id, "?tag=animals&tag=adults", False)
+
+	# upload and remove a cover image
+	with open("./resources/bird-eagle.png", "rb") as file:
+		cover_id = upload_resource(backend+"/packs/"+pack_id+"/cover", file, "image/png", "post")
+		verify_image_resource(media(cover_id), file, "image/png")
+	response = requests.get(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+	assert response.json()["cover"] == cover_id
+	with open("./resources/bird-eagle.mp3", "rb") as file:
+		file.seek(0)
+		response = requests.post(
+			backend+"/packs/"+pack_id+"/cover", headers={"Content-Type":"audio/mpeg"}, data=file
+		)
+		assert response.status_code == 400
+	response = requests.patch(backend+"/packs/"+pack_id, json={"cover":None})
+	assert response.status_code == 200
+	response = requests.get(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+	assert "cover" not in response.json()
+
+	response = requests.delete(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+
+def test_pack_labels(backend, media):
+	pack_id = create_test_pack(backend, "Test Pack Labels")
+	populate_test_pack_resources(backend, media, pack_id)
+	response = requests.get(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+	expected_hash = response.json()["hash"]
+
+	response = requests.patch(backend+"/packs/"+pack_id+"/mammal", json={"label":"Mammals"})
+	assert response.status_code == 200
+	response = requests.patch(backend+"/packs/"+pack_id+"/bird", json={"position":1})
+	assert response.status_code == 200
+	response = requests.patch(
+		backend+"/packs/"+pack_id+"/bird/eagle", json={"label":" Bald Eagle ", "position":-1}
+	)
+	assert response.status_code == 200
+	response = requests.patch(
+		backend+"/packs/"+pack_id+"/mammal/cat", json={"label":"Cha\u0302t"}
+	)
+	assert response.status_code == 200
+	response = requests.patch(backend+"/packs/"+pack_id+"/Invalid", json={"label":"Invalid"})
+	assert response.status_code == 400
+
+	# roles and strings without resources cannot be labelled
+	response = requests.patch(backend+"/packs/"+pack_id+"/fish", json={"label":"Fish"})
+	assert response.status_code == 404
+	response = requests.patch(backend+"/packs/"+pack_id+"/bird/parrot", json={"label":"Parrot"})
+	assert response.status_code == 404
+	response = requests.patch(backend+"/packs/0/bird", json={"label":"Birds"})
+	assert response.status_code == 404
+
+	# labels and positions are returned, ordered by position then id
+	response = requests.get(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+	roles = response.json()["roles"]
+	assert [role["id"] for role in roles] == ["mammal", "bird"]
+	assert roles[0]["label"] == "Mammals"
+	assert roles[0]["strings"][0]["label"] == "Ch\u00e2t"
+	assert roles[1]["position"] == 1
+	assert [string["id"] for string in roles[1]["strings"]] == ["eagle", "duck", "robin"]
+	assert roles[1]["strings"][0]["label"] == "Bald Eagle"
+	assert roles[1]["strings"][0]["position"] == -1
+
+	# labels do not affect the hash
+	verify_pack_hash(backend, pack_id, expected_hash)
+
+	# labels are deleted with their string, rather than reappearing when it is re-added
+	response = requests.delete(backend+"/packs/"+pack_id+"/mammal/cat")
+	assert response.status_code == 200
+	with open("./resources/mammal-cat.jpg", "rb") as file:
+		upload_resource(backend+"/packs/"+pack_id+"/mammal/cat", file, "image/jpeg")
+	response = requests.get(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+	cat = [s for s in response.json()["roles"][0]["strings"] if s["id"] == "cat"][0]
+	assert "label" not in cat
+
+	response = requests.delete(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+
+def test_pack_text_resource(backend, media):
+	pack_id = create_test_pack(backend, "Test Pack Text")
+	pack_api = backend + "/packs/" + pack_id
+
+	caption = io.BytesIO("The **bald eagle** \U0001F985".encode("utf-8"))
+	text_id = upload_resource(pack_api+"/bird/eagle", caption, "text/markdown")
+	verify_resource(media(text_id), caption, "text/markdown; charset=utf-8")
+	response = requests.get(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+	caption_bytes = caption.getvalue()
+	roles = response.json()["roles"]
+	verify_resource(roles[0]["strings"][0].pop("textUrl"), caption, "text/markdown; charset=utf-8")
+	assert roles == [
+		{
+			"id":"bird",
+			"strings":[
+				{
+					"id":"eagle",
+					"text":text_id,
+					"textMetadata":{
+						"contentType":"text/markdown; charset=utf-8",
+						"size":len(caption_bytes),
+						"sha256":hashlib.sha256(caption_bytes).hexdigest()
+					}
+				}
+			]
+		}
+	]
+
+	response = requests.put(
+		pack_api+"/bird/duck", headers={"Content-Type":"text/plain"}, data=b"\xff\xfe"
+	)
+	assert response.status_code == 400
+	response = requests.put(
+		pack_api+"/bird/duck", headers={"Content-Type":"text/plain; charset=latin1"}, data=b"duck"
+	)
+	assert response.status_code == 400
+	response = requests.put(
+		pack_api+"/bird/duck", headers={"Content-Type":"text/plain"}, data=b"a" * (64 * 1024 + 1)
+	)
+	assert response.status_code == 413
+
+	response = requests.delete(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+
+def test_pack_video_resource(backend, media):
+	pack_id = create_test_pack(backend, "Test Pack Video")
+	pack_api = backend + "/packs/" + pack_id
+
+	video_bytes = build_test_mp4(640, 360, 2500)
+	video = io.BytesIO(video_bytes)
+	video_id = upload_resource(pack_api+"/bird/eagle", video, "video/mp4")
+	verify_resource(media(video_id), video, "video/mp4")
+	response = requests.get(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+	roles = response.json()["roles"]
+	verify_resource(roles[0]["strings"][0].pop("videoUrl"), video, "video/mp4")
+	assert roles == [
+		{
+			"id":"bird",
+			"strings":[
+				{
+					"id":"eagle",
+					"video":video_id,
+					"videoMetadata":{
+						"contentType":"video/mp4",
+						"width":640,
+						"height":360,
+						"duration":2.5,
+						"size":len(video_bytes),
+						"sha256":hashlib.sha256(video_bytes).hexdigest()
+					}
+				}
+			]
+		}
+	]
+
+	# the leading bytes are of a webm, but its metadata cannot be read
+	response = requests.put(
+		pack_api+"/bird/duck", headers={"Content-Type":"video/webm"}, data=b"\x1a\x45\xdf\xa3not a video"
+	)
+	assert response.status_code == 400
+
+	response = requests.delete(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+
+def test_pack_resource_sniffing(backend):
+	pack_id = create_test_pack(backend, "Test Pack Sniffing")
+	pack_api = backend + "/packs/" + pack_id
+
+	html = b"<html><body><script>alert(1)</script></body></html>"
+	response = requests.put(pack_api+"/bird/eagle", headers={"Content-Type":"image/png"}, data=html)
+	assert response.status_code == 415
+	response = requests.put(pack_api+"/bird/eagle", headers={"Content-Type":"image/svg+xml"}, data=html)
+	assert response.status_code == 415
+	with open("./resources/bird-eagle.png", "rb") as file:
+		response = requests.put(pack_api+"/bird/eagle", headers={"Content-Type":"image/jpeg"}, data=file)
+		assert response.status_code == 415
+	with open("./resources/mammal-tiger.wav", "rb") as file:
+		response = requests.put(pack_api+"/bird/eagle", headers={"Content-Type":"audio/mpeg"}, data=file)
+		assert response.status_code == 415
+
+	# nothing was stored
+	response = requests.get(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+	assert response.json()["roles"] == []
+
+	response = requests.delete(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+
+def test_pack_image_variants(backend, media):
+	pack_id = create_test_pack(backend, "Test Pack Variants")
+	pack_api = backend + "/packs/" + pack_id
+
+	with open("./resources/mammal-cat.jpg", "rb") as file:
+		image_id = upload_resource(pack_api+"/mammal/cat", file, "image/jpeg")
+	response = requests.get(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+	variants = response.json()["roles"][0]["strings"][0]["imageVariants"]
+	verify_image_variants(media, variants)
+	# aspect ratio is kept
+	assert [(v["width"], v["height"]) for v in variants] == [(128, 96), (512, 384), (1024, 768)]
+	verify_blurhash(response.json()["roles"][0]["strings"][0]["imageBlurHash"], 4, 3)
+
+	# variants are pruned along with the original
+	response = requests.delete(pack_api+"/mammal/cat")
+	assert response.status_code == 200
+	for resource_id in [image_id] + [v["id"] for v in variants]:
+		retry_assert(lambda: verify_resource_deleted(media(resource_id)), timeout=10)
+
+	response = requests.delete(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+
+def test_pack_audio_waveforms(backend, media):
+	pack_id = create_test_pack(backend, "Test Pack Waveforms")
+	pack_api = backend + "/packs/" + pack_id
+
+	waveforms = {}
+	for file_name, content_type, duration_ms in [
+		("bird-eagle.mp3", "audio/mpeg", 4560),
+		("mammal-cat.flac", "audio/flac", 1544),
+		("mammal-tiger.wav", "audio/wav", 1247),
+	]:
+		role_id, string_id = file_name.split(".")[0].split("-")
+		with open("./resources/"+file_name, "rb") as file:
+			audio_id = upload_resource(pack_api+"/"+role_id+"/"+string_id, file, content_type)
+		response = requests.get(backend+"/resources/"+audio_id+"/waveform")
+		assert response.status_code == 200
+		peaks = response.json()["peaks"]
+		# a peak every 10ms for audio this short
+		assert abs(len(peaks) - duration_ms / 10) <= 5
+		assert all(0 <= peak <= 1 for peak in peaks)
+		assert max(peaks) > 0.1
+		waveforms[audio_id] = peaks
+
+	# only wav, flac and mp3 are decoded
+	with open("./resources/bird-duck.aac", "rb") as file:
+		audio_id = upload_resource(pack_api+"/bird/duck", file, "audio/aac")
+	response = requests.get(backend+"/resources/"+audio_id+"/waveform")
+	assert response.status_code == 404
+
+	response = requests.get(backend+"/resources/not-a-resource/waveform")
+	assert response.status_code == 400
+
+	# waveforms are pruned along with their resource
+	response = requests.delete(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+	for audio_id in waveforms:
+		retry_assert(
+			lambda: verify_resource_deleted(backend+"/resources/"+audio_id+"/waveform"), timeout=10
+		)
+
+def test_pack_loudness_report(backend, media):
+	pack_id = create_test_pack(backend, "Test Pack Loudness")
+	pack_api = backend + "/packs/" + pack_id
+
+	ids = {}
+	for file_name, content_type in [
+		("bird-duck.aac", "audio/aac"),
+		("bird-eagle.mp3", "audio/mpeg"),
+		("bird-robin.mp3", "audio/mpeg"),
+		("mammal-cat.flac", "audio/flac"),
+		("mammal-tiger.wav", "audio/wav"),
+	]:
+		role_id, string_id = file_name.split(".")[0].split("-")
+		with open("./resources/"+file_name, "rb") as file:
+			ids[string_id] = upload_resource(pack_api+"/"+role_id+"/"+string_id, file, content_type)
+
+	response = requests.get(pack_api+"/loudness")
+	assert response.status_code == 200
+	report = response.json()
+	assert report["targetLoudness"] == -16
+	assert report["medianLoudness"] == -15.1
+	clips = {clip["string"]: clip for clip in report["clips"]}
+	assert [clip["string"] for clip in report["clips"]] == ["duck", "eagle", "robin", "cat", "tiger"]
+	for string_id, clip in clips.items():
+		assert clip["audio"] == ids[string_id]
+	# aac cannot be decoded, so it is not measured
+	assert clips["duck"] == {
+		"role":"bird", "string":"duck", "audio":ids["duck"],
+		"loudness":None, "peak":None, "gain":None, "deviation":None, "flags":["unmeasured"],
+	}
+	assert clips["robin"]["loudness"] == -14.9
+	assert clips["robin"]["gain"] == -1.1
+	assert clips["eagle"]["deviation"] == -3.3
+	# the cat is far louder than the rest of the pack
+	assert clips["cat"]["deviation"] == 9.6
+	assert {string_id: clip["flags"] for string_id, clip in clips.items()} == {
+		"duck":["unmeasured"], "eagle":[], "robin":[], "cat":["clipped", "loud"], "tiger":["clipped"],
+	}
+
+	response = requests.get(backend+"/packs/0/loudness")
+	assert response.status_code == 404
+
+	response = requests.delete(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+
+def test_pack_resource_deduplication(backend, media):
+	first_pack_id = create_test_pack(backend, "Test Pack Dedupe 1")
+	second_pack_id = create_test_pack(backend, "Test Pack Dedupe 2")
+	first_api = backend + "/packs/" + first_pack_id
+	second_api = backend + "/packs/" + second_pack_id
+
+	# identical uploads share a resource, wherever they are used
+	with open("./resources/bird-eagle.mp3", "rb") as file:
+		audio_id = upload_resource(first_api+"/bird/eagle", file, "audio/mpeg")
+		assert upload_resource(second_api+"/bird/eagle", file, "audio/mpeg") == audio_id
+		assert upload_resource(second_api+"/bird/hawk", file, "audio/mpeg") == audio_id
+	with open("./resources/bird-robin.jpg", "rb") as file:
+		image_id = upload_resource(first_api+"/bird/robin", file, "image/jpeg")
+		assert upload_resource(second_api+"/cover", file, "image/jpeg", "post") == image_id
+	# but only when the content type matches too
+	text_ids = []
+	for string_id, content_type in [("eagle", "text/plain"), ("hawk", "text/plain"), ("robin", "text/markdown")]:
+		response = requests.put(
+			first_api+"/bird/"+string_id, headers={"Content-Type":content_type}, data=b"A bird"
+		)
+		assert response.status_code == 200
+		text_ids.append(response.json())
+	assert text_ids[0] == text_ids[1] != text_ids[2]
+
+	# the shared resources outlive the first pack
+	response = requests.delete(backend+"/packs/"+first_pack_id)
+	assert response.status_code == 200
+	with open("./resources/bird-eagle.mp3", "rb") as file:
+		verify_resource(media(audio_id), file, "audio/mpeg")
+	with open("./resources/bird-robin.jpg", "rb") as file:
+		third_pack_id = create_test_pack(backend, "Test Pack Dedupe 3")
+		third_api = backend + "/packs/" + third_pack_id
+		assert upload_resource(third_api+"/bird/robin", file, "image/jpeg") == image_id
+	response = requests.get(third_api)
+	assert response.status_code == 200
+	variants = response.json()["roles"][0]["strings"][0]["imageVariants"]
+	verify_image_variants(media, variants)
+
+	# and are pruned along with their variants once nothing uses them
+	response = requests.delete(backend+"/packs/"+second_pack_id)
+	assert response.status_code == 200
+	response = requests.delete(backend+"/packs/"+third_pack_id)
+	assert response.status_code == 200
+	for resource_id in [audio_id, image_id] + [v["id"] for v in variants]:
+		retry_assert(lambda: verify_resource_deleted(media(resource_id)), timeout=10)
+
+def test_pack_resource_digests(backend, media):
+	pack_id = create_test_pack(backend, "Test Pack Digests")
+	pack_api = backend + "/packs/" + pack_id
+
+	with open("./resources/mammal-cat.flac", "rb") as file:
+		data = file.read()
+	sha256 = base64.b64encode(hashlib.sha256(data).digest()).decode()
+	md5 = base64.b64encode(hashlib.md5(data).digest()).decode()
+	wrong = base64.b64encode(hashlib.sha256(b"not the audio").digest()).decode()
+
+	# each header is verified, and the digest of what was received is echoed
+	for headers in [
+		{},
+		{"Content-MD5":md5},
+		{"Digest":"SHA-256="+sha256},
+		{"Digest":"unixsum=1234, sha-256="+sha256},
+		{"Repr-Digest":"sha-256=:"+sha256+":"},
+		{"Content-MD5":md5, "Repr-Digest":"sha-256=:"+sha256+":"},
+	]:
+		headers["Content-Type"] = "audio/flac"
+		response = requests.put(pack_api+"/mammal/cat", headers=headers, data=data)
+		assert response.status_code == 200, headers
+		assert response.headers["Repr-Digest"] == "sha-256=:"+sha256+":"
+
+	# mismatched uploads are rejected, in full or in chunks, and leave the resource as it was
+	audio_id = response.json()
+	for headers in [
+		{"Content-MD5":base64.b64encode(hashlib.md5(b"not the audio").digest()).decode()},
+		{"Digest":"sha-256="+wrong},
+		{"Repr-Digest":"sha-256=:"+wrong+":"},
+		{"Content-MD5":md5, "Repr-Digest":"sha-256=:"+wrong+":"},
+	]:
+		headers["Content-Type"] = "audio/flac"
+		response = requests.put(pack_api+"/mammal/cat", headers=headers, data=data)
+		assert response.status_code == 400, headers
+		response = requests.put(pack_api+"/mammal/cat", headers=headers, data=iter([data[:1000], data[1000:]]))
+		assert response.status_code == 400, headers
+	response = requests.put(
+		pack_api+"/mammal/cat", headers={"Content-Type":"audio/flac", "Repr-Digest":"sha-256=abc"}, data=data
+	)
+	assert response.status_code == 400
+	response = requests.get(backend+"/packs/"+pack_id)
+	assert response.json()["roles"][0]["strings"][0]["audio"] == audio_id
+
+	# images are verified as sent, before their metadata is stripped, but the digest
+	# returned is of what is stored and served
+	with open("./resources/mammal-cat.jpg", "rb") as file:
+		data = file.read()
+	sha256 = base64.b64encode(hashlib.sha256(data).digest()).decode()
+	response = requests.put(
+		pack_api+"/mammal/cat", headers={"Content-Type":"image/jpeg", "Repr-Digest":"sha-256=:"+sha256+":"}, data=data
+	)
+	assert response.status_code == 200
+	stored = requests.get(media(response.json()))
+	assert stored.status_code == 200
+	assert response.headers["Repr-Digest"] == "sha-256=:"+base64.b64encode(hashlib.sha256(stored.content).digest()).decode()+":"
+
+	response = requests.delete(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+
+def test_pack_resumable_upload(backend, media):
+	pack_id = create_test_pack(backend, "Test Pack Resumable Upload")
+	chunk_size = 5 * 1024 * 1024
+	audio = build_test_wav(48000, chunk_size + 96000)
+	upload = {"pack":pack_id, "role":"bird", "string":"tone", "contentType":"audio/wav", "size":len(audio)}
+
+	# only audio and video of a known size within the limits can be uploaded in chunks
+	for overrides, status_code in [
+		({"contentType":"image/png"}, 400),
+		({"size":0}, 400),
+		({"size":1024 * 1024 * 1024}, 413),
+		({"pack":"1"}, 404),
+		({"role":"Not Valid"}, 400),
+	]:
+		response = requests.post(backend+"/uploads/", json={**upload, **overrides})
+		assert response.status_code == status_code, overrides
+
+	response = requests.post(backend+"/uploads/", json=upload)
+	assert response.status_code == 200
+	assert response.json()["offset"] == 0
+	assert response.json()["size"] == len(audio)
+	upload_api = backend + "/uploads/" + response.json()["id"]
+
+	# chunks other than the last must be at least 5 MiB, and a chunk that fails
+	# verification is not kept
+	response = requests.patch(upload_api, headers={"Upload-Offset":"0"}, data=audio[:1024])
+	assert response.status_code == 400
+	wrong = base64.b64encode(hashlib.sha256(b"not the chunk").digest()).decode()
+	response = requests.patch(
+		upload_api, headers={"Upload-Offset":"0", "Repr-Digest":"sha-256=:"+wrong+":"}, data=audio[:chunk_size]
+	)
+	assert response.status_code == 400
+	response = requests.get(upload_api)
+	assert response.status_code == 200
+	assert response.json()["offset"] == 0
+
+	sha256 = base64.b64encode(hashlib.sha256(audio[:chunk_size]).digest()).decode()
+	response = requests.patch(
+		upload_api, headers={"Upload-Offset":"0", "Repr-Digest":"sha-256=:"+sha256+":"}, data=audio[:chunk_size]
+	)
+	assert response.status_code == 200
+	assert response.json()["offset"] == chunk_size
+
+	# chunks must resume from the offset, and the upload must be complete to finalize
+	response = requests.patch(upload_api, headers={"Upload-Offset":"0"}, data=audio[:chunk_size])
+	assert response.status_code == 409
+	response = requests.post(upload_api+"/finalize")
+	assert response.status_code == 409
+	response = requests.get(upload_api)
+	assert response.json()["offset"] == chunk_size
+
+	response = requests.patch(upload_api, headers={"Upload-Offset":str(chunk_size)}, data=audio[chunk_size:])
+	assert response.status_code == 200
+	assert response.json()["offset"] == len(audio)
+	response = requests.post(upload_api+"/finalize")
+	assert response.status_code == 200
+	audio_id = response.json()
+	assert isinstance(audio_id, str)
+
+	# the resource is probed and analyzed as if it were uploaded in one go
+	response = requests.get(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+	tone = response.json()["roles"][0]["strings"][0]
+	assert tone["audio"] == audio_id
+	assert abs(tone["audioMetadata"]["duration"] - len(audio[44:]) / 2 / 48000) < 0.001
+	assert tone["audioMetadata"]["sampleRate"] == 48000
+	assert tone["audioMetadata"]["loudness"] == -9.7
+	assert tone["audioMetadata"]["peak"] == -6.0
+	verify_resource(media(audio_id), io.BytesIO(audio), "audio/wav")
+	response = requests.get(backend+"/resources/"+audio_id+"/waveform")
+	assert response.status_code == 200
+	response = requests.get(upload_api)
+	assert response.status_code == 404
+
+	# abandoned uploads can be discarded
+	response = requests.post(backend+"/uploads/", json=upload)
+	assert response.status_code == 200
+	upload_api = backend + "/uploads/" + response.json()["id"]
+	response = requests.patch(upload_api, headers={"Upload-Offset":"0"}, data=audio[:chunk_size])
+	assert response.status_code == 200
+	response = requests.delete(upload_api)
+	assert response.status_code == 200
+	response = requests.get(upload_api)
+	assert response.status_code == 404
+	response = requests.post(upload_api+"/finalize")
+	assert response.status_code == 404
+
+	response = requests.delete(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+
+def test_pack_presigned_upload(backend, media):
+	pack_id = create_test_pack(backend, "Test Pack Presigned Upload")
+	with open("./resources/mammal-tiger.wav", "rb") as file:
+		audio = file.read()
+	upload = {
+		"pack":pack_id, "role":"mammal", "string":"tiger", "contentType":"audio/wav", "size":len(audio), "presigned":True,
+	}
+
+	# images are sanitized by the backend, so they cannot be sent straight to s3
+	response = requests.post(backend+"/uploads/", json={**upload, "contentType":"image/png"})
+	assert response.status_code == 400
+
+	response = requests.post(backend+"/uploads/", json=upload)
+	assert response.status_code == 200
+	url, headers = response.json()["url"], response.json()["headers"]
+	assert headers["Content-Type"] == "audio/wav"
+	assert "X-Amz-Expires=900" in url
+	upload_api = backend + "/uploads/" + response.json()["id"]
+
+	# nothing has been put yet, and presigned uploads are not sent in chunks
+	response = requests.post(upload_api+"/finalize")
+	assert response.status_code == 409
+	response = requests.patch(upload_api, headers={"Upload-Offset":"0"}, data=audio)
+	assert response.status_code == 400
+
+	# s3 rejects anything other than the size and content type that were signed
+	response = requests.put(url, headers={**headers, "Content-Type":"audio/flac"}, data=audio)
+	assert response.status_code == 403
+	response = requests.put(url, headers={"Content-Type":"audio/wav"}, data=audio+b"extra")
+	assert response.status_code == 403
+
+	response = requests.put(url, headers=headers, data=audio)
+	assert response.status_code == 200
+	response = requests.post(upload_api+"/finalize")
+	assert response.status_code == 200
+	audio_id = response.json()
+	assert isinstance(audio_id, str)
+	response = requests.post(upload_api+"/finalize")
+	assert response.status_code == 404
+
+	# the resource is probed as if it were uploaded through the backend
+	response = requests.get(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+	tiger = response.json()["roles"][0]["strings"][0]
+	assert tiger["audio"] == audio_id
+	assert tiger["audioMetadata"]["duration"] == 1.247
+	verify_resource(media(audio_id), io.BytesIO(audio), "audio/wav")
+
+	# the upload was copied, so putting to the url again does not replace it
+	response = requests.put(url, headers=headers, data=audio[::-1])
+	assert response.status_code == 200
+	verify_resource(media(audio_id), io.BytesIO(audio), "audio/wav")
+
+	response = requests.delete(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+
+def test_pack_resource_streaming(backend, media):
+	pack_id = create_test_pack(backend, "Test Pack Streaming")
+	pack_api = backend + "/packs/" + pack_id
+	with open("./resources/mammal-tiger.wav", "rb") as file:
+		audio = file.read()
+		audio_id = upload_resource(pack_api+"/mammal/tiger", file, "audio/x-wav")
+	audio_api = pack_api + "/mammal/tiger/audio"
+
+	# served with its canonical content type, revalidated by etag unless pinned
+	response = requests.get(audio_api)
+	assert response.status_code == 200
+	assert response.headers["Content-Type"] == "audio/wav"
+	assert response.headers["ETag"] == '"'+audio_id+'"'
+	assert response.headers["Accept-Ranges"] == "bytes"
+	assert response.headers["Cache-Control"] == "private, no-cache"
+	assert response.content == audio
+	response = requests.get(audio_api, params={"v":audio_id})
+	assert response.status_code == 200
+	assert response.headers["Cache-Control"] == "private, max-age=31536000, immutable"
+	response = requests.get(audio_api, headers={"If-None-Match":'W/"1", "'+audio_id+'"'})
+	assert response.status_code == 304
+	assert response.content == b""
+
+	# single byte ranges, for seeking
+	for byte_range, start, end in [
+		("bytes=0-99", 0, 99),
+		("bytes=1000-", 1000, len(audio) - 1),
+		("bytes=-10", len(audio) - 10, len(audio) - 1),
+	]:
+		response = requests.get(audio_api, headers={"Range":byte_range})
+		assert response.status_code == 206, byte_range
+		assert response.headers["Content-Range"] == "bytes %d-%d/%d" % (start, end, len(audio))
+		assert response.content == audio[start:end+1]
+	response = requests.get(audio_api, headers={"Range":"bytes=%d-" % len(audio)})
+	assert response.status_code == 416
+	response = requests.get(audio_api, headers={"Range":"bytes=0-99", "If-Range":'"1"'})
+	assert response.status_code == 200
+	assert response.content == audio
+
+	# replaced resources are no longer served under a pin
+	with open("./resources/mammal-cat.flac", "rb") as file:
+		upload_resource(pack_api+"/mammal/tiger", file, "audio/flac")
+	response = requests.get(audio_api, params={"v":audio_id})
+	assert response.status_code == 404
+	response = requests.get(audio_api)
+	assert response.status_code == 200
+	assert response.headers["Content-Type"] == "audio/flac"
+
+	for path, status_code in [
+		("/mammal/tiger/image", 404),
+		("/mammal/lion/audio", 404),
+		("/mammal/tiger/sound", 400),
+	]:
+		response = requests.get(pack_api+path)
+		assert response.status_code == status_code, path
+
+	response = requests.delete(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+
+def test_pack_media_urls(backend, media):
+	pack_id = create_test_pack(backend, "Test Pack Media URLs")
+	pack_api = backend + "/packs/" + pack_id
+	with open("./resources/mammal-cat.jpg", "rb") as file:
+		upload_resource(pack_api+"/cover", file, "image/jpeg", "post")
+	with open("./resources/bird-eagle.png", "rb") as file:
+		upload_resource(pack_api+"/bird/eagle", file, "image/png")
+	with open("./resources/bird-eagle.mp3", "rb") as file:
+		upload_resource(pack_api+"/bird/eagle", file, "audio/mpeg")
+
+	# each resource has a presigned url alongside its id, which serves the same content
+	response = requests.get(pack_api)
+	assert response.status_code == 200
+	pack = response.json()
+	eagle = pack["roles"][0]["strings"][0]
+	urls = {
+		pack["cover"]:pack["coverUrl"],
+		eagle["image"]:eagle["imageUrl"],
+		eagle["audio"]:eagle["audioUrl"],
+	}
+	for variant in eagle["imageVariants"]:
+		urls[variant["id"]] = variant["url"]
+	# with the content type they are served with
+	assert pack["coverContentType"] == "image/jpeg"
+	assert eagle["imageMetadata"]["contentType"] == "image/png"
+	assert eagle["audioMetadata"]["contentType"] == "audio/mpeg"
+	for resource_id, url in urls.items():
+		assert url.split("?")[0] == media(resource_id).split("?")[0]
+		assert "X-Amz-Expires=3600" in url
+		response = requests.get(url)
+		assert response.status_code == 200
+		assert response.content == requests.get(media(resource_id)).content
+		# the bucket is private, so media cannot be fetched without a signature
+		response = requests.get(url.split("?")[0])
+		assert response.status_code == 403
+
+	# urls stay the same for a while, so that they can be cached
+	response = requests.get(pack_api)
+	assert response.json()["roles"][0]["strings"][0]["audioUrl"] == eagle["audioUrl"]
+
+	# urls cannot be altered to fetch other resources
+	response = requests.get(eagle["audioUrl"].replace(eagle["audio"], eagle["image"]))
+	assert response.status_code == 403
+
+	response = requests.delete(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+
+def test_pack_lifecycle(backend, media):
+	pack_id = create_test_pack(backend, "Test Pack Lifecycle")
+	pack_api = backend + "/packs/" + pack_id
+
+	# packs start as unpublished drafts
+	response = requests.get(pack_api)
+	assert response.status_code == 200
+	pack = response.json()
+	assert (pack["status"], pack["revision"]) == ("draft", 1)
+	assert "publishedRevision" not in pack
+	assert pack["requiredClasses"] == ["image", "audio"]
+	response = requests.get(pack_api, params={"revision":"published"})
+	assert response.status_code == 404
+	verify_pack_listed(backend, pack_id, "?status=draft", True)
+	verify_pack_listed(backend, pack_id, "?status=published", False)
+	verify_pack_listed(backend, pack_id, "?revision=published", False)
+
+	# every string must have the required resource classes
+	response = requests.post(pack_api+"/publish")
+	assert response.status_code == 422
+	assert [p["rule"] for p in response.json()["problems"]] == ["no_strings"]
+	with open("./resources/bird-eagle.png", "rb") as file:
+		eagle_image_id = upload_resource(pack_api+"/bird/eagle", file, "image/png")
+	response = requests.get(pack_api+"/bird/eagle/image", params={"revision":"published"})
+	assert response.status_code == 404
+	response = requests.post(pack_api+"/publish")
+	assert response.status_code == 422
+	problems = [p for p in response.json()["problems"] if p["blocking"]]
+	assert [(p["role"], p["string"], p["missing"]) for p in problems] == [("bird", "eagle", ["audio"])]
+	response = requests.patch(pack_api, json={"requiredClasses":["sound"]})
+	assert response.status_code == 400
+	response = requests.patch(pack_api, json={"requiredClasses":["image", "image"]})
+	assert response.status_code == 200
+	response = requests.post(pack_api+"/publish")
+	assert response.status_code == 200
+	assert response.json() == {"status":"published", "revision":1, "publishedRevision":1}
+	verify_pack_listed(backend, pack_id, "?status=published", True)
+	verify_pack_listed(backend, pack_id, "?revision=published", True)
+
+	# edits to a published pack make a new draft revision, leaving the published one as it was
+	response = requests.patch(pack_api, json={"title":"Test Pack Lifecycle Draft"})
+	assert response.status_code == 200
+	with open("./resources/bird-robin.jpg", "rb") as file:
+		robin_image_id = upload_resource(pack_api+"/bird/eagle", file, "image/jpeg")
+	audio_id = upload_resource(pack_api+"/bird/eagle", io.BytesIO(build_test_wav(44100, 88200)), "audio/wav")
+	response = requests.get(pack_api)
+	pack = response.json()
+	assert (pack["title"], pack["status"], pack["revision"], pack["publishedRevision"]) == (
+		"Test Pack Lifecycle Draft", "published", 2, 1
+	)
+	assert pack["roles"][0]["strings"][0]["image"] == robin_image_id
+	response = requests.get(pack_api, params={"revision":"published"})
+	assert response.status_code == 200
+	pack = response.json()
+	assert (pack["title"], pack["status"], pack["revision"], pack["publishedRevision"]) == (
+		"Test Pack Lifecycle", "published", 1, 1
+	)
+	eagle = pack["roles"][0]["strings"][0]
+	assert eagle["image"] == eagle_image_id
+	assert len(eagle["imageVariants"]) == 3
+	response = requests.get(backend+"/packs/", params={"revision":"published"})
+	summary = next(p for p in response.json() if p["id"] == pack_id)
+	assert (summary["title"], summary["roleCount"], summary["stringCount"]) == ("Test Pack Lifecycle", 1, 1)
+	# the replaced image is kept while it is published
+	time.sleep(1)
+	for url in [eagle["imageUrl"], media(eagle_image_id)]:
+		response = requests.get(url)
+		assert response.status_code == 200
+	# and is what is streamed from the published revision, which has no audio yet
+	response = requests.get(pack_api+"/bird/eagle/image", params={"revision":"published"})
+	assert response.status_code == 200
+	assert response.headers["ETag"] == '"'+eagle_image_id+'"'
+	# which can be stored by shared caches, unlike the draft
+	assert response.headers["Cache-Control"] == "public, no-cache"
+	response = requests.get(pack_api+"/bird/eagle/image", params={"revision":"published", "v":eagle_image_id})
+	assert response.headers["Cache-Control"] == "public, max-age=31536000, immutable"
+	response = requests.get(pack_api+"/bird/eagle/image")
+	assert response.headers["ETag"] == '"'+robin_image_id+'"'
+	response = requests.get(pack_api+"/bird/eagle/audio", params={"revision":"published"})
+	assert response.status_code == 404
+	response = requests.get(backend+"/resources/"+audio_id+"/waveform", params={"revision":"published"})
+	assert response.status_code == 404
+	response = requests.get(backend+"/resources/"+audio_id+"/waveform")
+	assert response.status_code == 200
+
+	# publishing the draft releases the previously published resources
+	response = requests.post(pack_api+"/publish")
+	assert response.status_code == 200
+	assert response.json() == {"status":"published", "revision":2, "publishedRevision":2}
+	response = requests.get(pack_api, params={"revision":"published"})
+	assert response.json()["title"] == "Test Pack Lifecycle Draft"
+	retry_assert(lambda: verify_resource_deleted(media(eagle_image_id)), timeout=10)
+	response = requests.get(backend+"/resources/"+audio_id+"/waveform", params={"revision":"published"})
+	assert response.status_code == 200
+
+	# archived packs are not listed, but can still be got
+	response = requests.post(pack_api+"/archive")
+	assert response.status_code == 200
+	assert response.json() == {"status":"archived", "revision":2, "publishedRevision":2}
+	verify_pack_listed(backend, pack_id, "?revision=published", False)
+	verify_pack_listed(backend, pack_id, "?status=archived", True)
+	response = requests.get(pack_api, params={"revision":"published"})
+	assert response.status_code == 200
+	assert response.json()["status"] == "archived"
+
+	# only published packs can be archived
+	draft_id = create_test_pack(backend, "Test Pack Lifecycle Unpublished")
+	response = requests.post(backend+"/packs/"+draft_id+"/archive")
+	assert response.status_code == 409
+	response = requests.get(backend+"/packs/", params={"status":"unknown"})
+	assert response.status_code == 400
+
+	# deleting the pack releases its published resources too
+	response = requests.delete(pack_api)
+	assert response.status_code == 200
+	retry_assert(lambda: verify_resource_deleted(media(robin_image_id)), timeout=10)
+	response = requests.delete(backend+"/packs/"+draft_id)
+	assert response.status_code == 200
+
+def test_pack_validation(backend, media):
+	pack_id = create_test_pack(backend, "Test Pack Validation")
+	pack_api = backend + "/packs/" + pack_id
+
+	response = requests.get(pack_api+"/validate")
+	assert response.status_code == 200
+	assert response.json() == {
+		"valid":False,
+		"problems":[{"rule":"no_strings", "blocking":True, "message":"pack has no strings"}],
+	}
+
+	# strings must have an image and audio
+	populate_test_pack_resources(backend, media, pack_id)
+	response = requests.get(pack_api+"/validate")
+	assert response.status_code == 200
+	report = response.json()
+	assert report["valid"] == False
+	assert [(p["rule"], p["blocking"], p["role"], p["string"], p["missing"]) for p in report["problems"]] == [
+		("missing_resources", True, "bird", "duck", ["image"]),
+		("missing_resources", True, "bird", "robin", ["audio"]),
+	]
+
+	# other problems are reported without blocking publishing
+	gif = base64.b64decode("R0lGODlhAQABAIAAAAAAAP///yH5BAEAAAAALAAAAAABAAEAAAIBRAA7")
+	upload_resource(pack_api+"/bird/owl", io.BytesIO(gif), "image/gif")
+	owl_audio_id = upload_resource(pack_api+"/bird/owl", io.BytesIO(build_test_wav(48000, 3 * 1024 * 1024)), "audio/wav")
+	with open("./resources/bird-eagle.png", "rb") as file:
+		bee_image_id = upload_resource(pack_api+"/insect/bee", file, "image/png")
+	with open("./resources/bird-eagle.mp3", "rb") as file:
+		bee_audio_id = upload_resource(pack_api+"/insect/bee", file, "audio/mpeg")
+	response = requests.get(pack_api+"/validate")
+	assert response.status_code == 200
+	problems = [p for p in response.json()["problems"] if not p["blocking"]]
+	for problem in problems:
+		assert problem.pop("message")
+	assert problems == [
+		{"rule":"few_strings", "blocking":False, "role":"insect"},
+		{"rule":"oversized_media", "blocking":False, "role":"bird", "string":"owl", "class":"audio", "resource":owl_audio_id},
+		{"rule":"duplicate_media", "blocking":False, "class":"image", "resource":bee_image_id, "strings":["bird/eagle", "insect/bee"]},
+		{"rule":"duplicate_media", "blocking":False, "class":"audio", "resource":bee_audio_id, "strings":["bird/eagle", "insect/bee"]},
+	]
+
+	response = requests.get(backend+"/packs/0/validate")
+	assert response.status_code == 404
+
+	response = requests.delete(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+
+def test_pack_svg_sanitization(backend, media):
+	pack_id = create_test_pack(backend, "Test Pack SVG")
+	pack_api = backend + "/packs/" + pack_id
+
+	svg = (
+		b'<?xml version="1.0"?>'
+		b'<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" onload="alert(1)">'
+		b'<script>alert(2)</script>'
+		b'<a xlink:href="javascript:alert(3)"><circle cx="5" cy="5" r="4" fill="red"/></a>'
+		b'<use href="#dot"/>'
+		b'</svg>'
+	)
+	response = requests.put(pack_api+"/bird/eagle", headers={"Content-Type":"image/svg+xml"}, data=svg)
+	assert response.status_code == 200
+	image_id = response.json()
+	assert response.headers["Removed-Content"] == "attribute onload, element script, attribute href"
+
+	response = requests.get(media(image_id))
+	assert response.status_code == 200
+	assert response.headers["Content-Type"] == "image/svg+xml"
+	assert response.content == (
+		b'<?xml version="1.0"?>'
+		b'<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">'
+		b'<a><circle cx="5" cy="5" r="4" fill="red"></circle></a>'
+		b'<use href="#dot"></use>'
+		b'</svg>'
+	)
+
+	# malformed svgs are rejected rather than partially stored
+	response = requests.put(
+		pack_api+"/bird/duck", headers={"Content-Type":"image/svg+xml"}, data=b"<svg><g></svg>"
+	)
+	assert response.status_code == 400
+
+	response = requests.delete(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+
+def test_pack_body_limits(backend):
+	pack_id = create_test_pack(backend, "Test Pack Limits")
+	pack_api = backend + "/packs/" + pack_id
+
+	# json bodies are limited
+	response = requests.patch(pack_api, json={"description":"a" * (64 * 1024)})
+	assert response.status_code == 413
+	assert response.json()["error"] == "request body exceeds 65536 bytes"
+
+	# chunked uploads are rejected once they exceed the limit
+	def chunks():
+		for _ in range(16):
+			yield b"a" * 8192
+	response = requests.put(pack_api+"/bird/eagle", headers={"Content-Type":"text/plain"}, data=chunks())
+	assert response.status_code == 413
+	assert response.json()["error"] == "text pack resource exceeds 65536 bytes"
+
+	response = requests.get(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+	assert response.json()["roles"] == []
+
+	response = requests.delete(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+
+def test_pack_pieces(backend, media):
+	pack_id = create_test_pack(backend, "Test Pack Pieces")
+	pack_api = backend + "/packs/" + pack_id
+	populate_test_pack_resources(backend, media, pack_id)
+	pack_hash = hashlib.sha256(
+		'\x00bird\x01duck\x01eagle\x01robin\x00mammal\x01cat\x01dog\x01tiger'.encode('utf-8')
+	).hexdigest()
+	verify_pack_hash(backend, pack_id, pack_hash)
+	pieces_api = backend + "/pieces/" + pack_hash + "/"
+
+	# pieces are titled seeds, which are generated unless given
+	response = requests.post(pieces_api, json={"title":" Opening Night "})
+	assert response.status_code == 200
+	generated = response.json()
+	assert generated["hash"] == pack_hash
+	assert generated["title"] == "Opening Night"
+	assert len(generated["seed"]) == 32 and int(generated["seed"], 16) >= 0
+	seed = "0123456789abcdef0123456789abcdef"
+	response = requests.post(pieces_api, json={"title":"Encore", "seed":seed})
+	assert response.status_code == 200
+	assert response.json() == {"hash":pack_hash, "seed":seed, "title":"Encore"}
+
+	response = requests.post(pieces_api, json={"title":"Encore", "seed":seed})
+	assert response.status_code == 409
+	for body in [{"title":"Bad Seed", "seed":"0123"}, {"title":"Bad Seed", "seed":seed.upper()}, {"title":" "}]:
+		response = requests.post(pieces_api, json=body)
+		assert response.status_code == 400
+	response = requests.post(backend+"/pieces/"+hashlib.sha256(b"no pack").hexdigest()+"/", json={"title":"Orphan"})
+	assert response.status_code == 404
+	response = requests.get(backend+"/pieces/"+pack_hash.upper()+"/")
+	assert response.status_code == 400
+
+	response = requests.get(pieces_api)
+	assert response.status_code == 200
+	assert [p for p in response.json() if p["seed"] in (seed, generated["seed"])] == [
+		{"hash":pack_hash, "seed":seed, "title":"Encore"},
+		generated,
+	]
+
+	# compatible packs are those with the hash, or published with it
+	response = requests.get(pieces_api+seed)
+	assert response.status_code == 200
+	piece = response.json()
+	assert (piece["hash"], piece["seed"], piece["title"]) == (pack_hash, seed, "Encore")
+	assert {"id":pack_id, "title":"Test Pack Pieces"} in piece["packs"]
+	response = requests.get(pieces_api+seed+"?revision=published")
+	assert response.status_code == 200
+	assert pack_id not in [p["id"] for p in response.json()["packs"]]
+
+	response = requests.patch(pack_api, json={"requiredClasses":[]})
+	assert response.status_code == 200
+	response = requests.post(pack_api+"/publish")
+	assert response.status_code == 200
+	response = requests.get(pieces_api+seed+"?revision=published")
+	assert response.status_code == 200
+	assert {"id":pack_id, "title":"Test Pack Pieces"} in response.json()["packs"]
+
+	# editing the strings leaves the piece for the published revision only
+	response = requests.delete(pack_api+"/bird/robin")
+	assert response.status_code == 200
+	response = requests.get(pieces_api+seed)
+	assert response.status_code == 200
+	assert pack_id not in [p["id"] for p in response.json()["packs"]]
+	response = requests.get(pieces_api+seed+"?revision=published")
+	assert response.status_code == 200
+	assert pack_id in [p["id"] for p in response.json()["packs"]]
+
+	for s in [seed, generated["seed"]]:
+		response = requests.delete(pieces_api+s)
+		assert response.status_code == 200
+		response = requests.get(pieces_api+s)
+		assert response.status_code == 404
+	response = requests.delete(pieces_api+seed)
+	assert response.status_code == 200
+
+	response = requests.delete(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+
 # HELPERS
 
 def create_test_pack(backend, title):
@@ -119,33 +1126,95 @@ def populate_test_pack_resources(backend, media, pack_id):
 		cat_audio_id = upload_resource(pack_api+"/mammal/cat", file, "audio/flac")
 	with open("./resources/mammal-dog.webp", "rb") as file:
 		dog_image_id = upload_resource(pack_api+"/mammal/dog", file, "image/webp")
+	with open("./resources/mammal-dog.m4a", "rb") as file:
+		dog_audio_id = upload_resource(pack_api+"/mammal/dog", file, "audio/x-m4a")
 	with open("./resources/mammal-tiger.svg", "rb") as file:
 		tiger_image_id = upload_resource(pack_api+"/mammal/tiger", file, "image/svg+xml")
 	with open("./resources/mammal-tiger.wav", "rb") as file:
 		tiger_audio_id = upload_resource(pack_api+"/mammal/tiger", file, "audio/wav")
 	# verify resource integrity
 	with open("./resources/bird-duck.aac", "rb") as file:
-		verify_resource(media+"/"+duck_audio_id, file, "audio/aac")
+		verify_resource(media(duck_audio_id), file, "audio/aac")
 	with open("./resources/bird-eagle.png", "rb") as file:
-		verify_resource(media+"/"+eagle_image_id, file, "image/png")
+		verify_image_resource(media(eagle_image_id), file, "image/png")
 	with open("./resources/bird-eagle.mp3", "rb") as file:
-		verify_resource(media+"/"+eagle_audio_id, file, "audio/mpeg")
+		verify_resource(media(eagle_audio_id), file, "audio/mpeg")
 	with open("./resources/bird-robin.jpg", "rb") as file:
-		verify_resource(media+"/"+robin_image_id, file, "image/jpeg")
+		verify_image_resource(media(robin_image_id), file, "image/jpeg")
 	with open("./resources/mammal-cat.jpg", "rb") as file:
-		verify_resource(media+"/"+cat_image_id, file, "image/jpeg")
+		verify_image_resource(media(cat_image_id), file, "image/jpeg")
 	with open("./resources/mammal-cat.flac", "rb") as file:
-		verify_resource(media+"/"+cat_audio_id, file, "audio/flac")
+		verify_resource(media(cat_audio_id), file, "audio/flac")
 	with open("./resources/mammal-dog.webp", "rb") as file:
-		verify_resource(media+"/"+dog_image_id, file, "image/webp")
+		verify_image_resource(media(dog_image_id), file, "image/webp")
+	with open("./resources/mammal-dog.m4a", "rb") as file:
+		# aliases are stored with the canonical content type
+		verify_resource(media(dog_audio_id), file, "audio/mp4")
 	with open("./resources/mammal-tiger.svg", "rb") as file:
-		verify_resource(media+"/"+tiger_image_id, file, "image/svg+xml")
+		verify_resource(media(tiger_image_id), file, "image/svg+xml")
 	with open("./resources/mammal-tiger.wav", "rb") as file:
-		verify_resource(media+"/"+tiger_audio_id, file, "audio/wav")
+		verify_resource(media(tiger_audio_id), file, "audio/wav")
 	# verify resource ids in get pack api
 	response = requests.get(backend+"/packs/"+pack_id)
 	assert response.status_code == 200
-	assert response.json()['roles'] == [
+	roles = response.json()['roles']
+	variants = {}
+	metadata = {}
+	gains = {}
+	blurhashes = {}
+	urls = {}
+	for role in roles:
+		for string in role["strings"]:
+			for key in ("audio", "image"):
+				if key+"Url" in string:
+					urls[string[key]] = string.pop(key+"Url")
+			if "imageVariants" in string:
+				variants[string["id"]] = string.pop("imageVariants")
+			if "imageBlurHash" in string:
+				blurhashes[string["id"]] = string.pop("imageBlurHash")
+			if "audioGain" in string:
+				gains[string["id"]] = string.pop("audioGain")
+			for key in ("audioMetadata", "imageMetadata"):
+				if key in string:
+					metadata[string["id"]+"/"+key] = string.pop(key)
+	# raster images are resized, vector images are not
+	assert variants.keys() == {"eagle", "robin", "cat", "dog"}
+	for image_variants in variants.values():
+		verify_image_variants(media, image_variants)
+	# and given placeholders, which are wider than they are tall like the images
+	assert blurhashes.keys() == {"eagle", "robin", "cat", "dog"}
+	for blurhash in blurhashes.values():
+		verify_blurhash(blurhash, 4, 3)
+	# metadata is read from each resource as it is uploaded
+	expected_metadata = {
+		"duck/audioMetadata":("bird-duck.aac", {"contentType":"audio/aac","duration":1.16,"sampleRate":44100,"channels":1}),
+		"eagle/audioMetadata":("bird-eagle.mp3", {"contentType":"audio/mpeg","duration":4.56,"sampleRate":48000,"channels":2,"loudness":-18.4,"peak":-12.0}),
+		"eagle/imageMetadata":("bird-eagle.png", {"contentType":"image/png","width":2293,"height":1529}),
+		"robin/imageMetadata":("bird-robin.jpg", {"contentType":"image/jpeg","width":2304,"height":1728}),
+		"cat/audioMetadata":("mammal-cat.flac", {"contentType":"audio/flac","duration":1.544,"sampleRate":44100,"channels":2,"loudness":-5.5,"peak":-0.1}),
+		"cat/imageMetadata":("mammal-cat.jpg", {"contentType":"image/jpeg","width":2016,"height":1512}),
+		"dog/audioMetadata":("mammal-dog.m4a", {"contentType":"audio/mp4","duration":0.6,"sampleRate":44100,"channels":2}),
+		"dog/imageMetadata":("mammal-dog.webp", {"contentType":"image/webp","width":1999,"height":1337}),
+		"tiger/audioMetadata":("mammal-tiger.wav", {"contentType":"audio/wav","duration":1.247,"sampleRate":48000,"channels":1,"loudness":-15.2,"peak":0.0}),
+		"tiger/imageMetadata":("mammal-tiger.svg", {"contentType":"image/svg+xml"}),
+	}
+	assert metadata.keys() == expected_metadata.keys()
+	for key, (filename, expected) in expected_metadata.items():
+		with open("./resources/"+filename, "rb") as file:
+			data = file.read()
+		# photos are stored with their metadata stripped
+		data = strip_image_metadata(data, expected["contentType"])
+		expected = dict(expected, size=len(data), sha256=hashlib.sha256(data).hexdigest())
+		assert metadata[key] == expected, key
+	# each resource has a url that serves it, alongside its id
+	assert len(urls) == 10
+	for resource_id, url in urls.items():
+		response = requests.get(url)
+		assert response.status_code == 200
+		assert response.content == requests.get(media(resource_id)).content
+	# gains bring decodable audio to -16 LUFS, without pushing peaks past -1 dBFS
+	assert gains == {"eagle":2.4, "cat":-10.5, "tiger":-1.0}
+	assert roles == [
 		{
 			"id":"bird",
 			"strings":[
@@ -158,7 +1227,7 @@ def populate_test_pack_resources(backend, media, pack_id):
 			"id":"mammal",
 			"strings":[
 				{"id":"cat","audio":cat_audio_id,"image":cat_image_id},
-				{"id":"dog","image":dog_image_id},
+				{"id":"dog","audio":dog_audio_id,"image":dog_image_id},
 				{"id":"tiger","audio":tiger_audio_id,"image":tiger_image_id}
 			]
 		}
@@ -187,6 +1256,25 @@ def verify_pack_counts(backend, pack_id, role_count, string_count):
 	assert filtered_data[0]['roleCount'] == role_count
 	assert filtered_data[0]['stringCount'] == string_count
 
+def verify_pack_metadata(backend, pack_id, metadata):
+	response = requests.get(backend+"/packs/"+pack_id)
+	assert response.status_code == 200
+	pack = response.json()
+	for key, value in metadata.items():
+		assert pack[key] == value
+	response = requests.get(backend+"/packs/")
+	assert response.status_code == 200
+	filtered_data = list(filter(lambda p: p['id'] == pack_id, response.json()))
+	assert len(filtered_data) == 1
+	for key, value in metadata.items():
+		assert filtered_data[0][key] == value
+
+def verify_pack_listed(backend, pack_id, query, listed):
+	response = requests.get(backend+"/packs/"+query)
+	assert response.status_code == 200
+	filtered_data = list(filter(lambda p: p['id'] == pack_id, response.json()))
+	assert len(filtered_data) == (1 if listed else 0)
+
 def verify_pack_title(backend, pack_id, title):
 	response = requests.get(backend+"/packs/"+pack_id)
 	assert response.status_code == 200
@@ -215,12 +1303,13 @@ def hash_response(res):
 		sha256.update(chunk)
 	return sha256.hexdigest()
 
-def upload_resource(url, file, content_type):
+def upload_resource(url, file, content_type, method="put"):
 	file.seek(0)
-	response = requests.put(url, headers={"Content-Type":content_type}, data=file)
+	response = requests.request(method, url, headers={"Content-Type":content_type}, data=file)
 	assert response.status_code == 200
 	resource_id = response.json()
 	assert isinstance(resource_id, str)
+	assert "Removed-Content" not in response.headers
 	return resource_id
 
 def verify_resource(url, file, content_type):
@@ -230,6 +1319,101 @@ def verify_resource(url, file, content_type):
 	assert response.headers["Content-Type"] == content_type
 	assert hash_response(response) == hash_file(file)
 
+def verify_image_resource(url, file, content_type):
+	# photos are served with their metadata stripped
+	file.seek(0)
+	expected = strip_image_metadata(file.read(), content_type)
+	response = requests.get(url)
+	assert response.status_code == 200
+	assert response.headers["Content-Type"] == content_type
+	assert hashlib.sha256(response.content).hexdigest() == hashlib.sha256(expected).hexdigest()
+
+def strip_image_metadata(data, content_type):
+	# mirrors the backend, except that the test images have no exif orientation to keep
+	if content_type == "image/png":
+		out, data = data[:8], data[8:]
+		while data:
+			size, chunk_type = struct.unpack(">I4s", data[:8])
+			if chunk_type not in (b"eXIf", b"tEXt", b"zTXt", b"iTXt", b"tIME"):
+				out += data[:size+12]
+			data = data[size+12:]
+		return out
+	if content_type == "image/jpeg":
+		out, data = data[:2], data[2:]
+		while True:
+			marker, size = data[1], struct.unpack(">H", data[2:4])[0]
+			segment, data = data[:size+2], data[size+2:]
+			if marker == 0xDA:
+				return out + segment + data
+			keep = (
+				(marker == 0xE0 and segment[4:9] in (b"JFIF\x00", b"JFXX\x00")) or
+				(marker == 0xE2 and segment[4:16] == b"ICC_PROFILE\x00") or
+				(marker == 0xEE and segment[4:9] == b"Adobe") or
+				not (0xE0 <= marker <= 0xEF or marker == 0xFE)
+			)
+			if keep:
+				out += segment
+	if content_type == "image/webp":
+		out, data = bytearray(data[:12]), data[12:]
+		while data:
+			fourcc, size = data[:4], struct.unpack("<I", data[4:8])[0]
+			chunk = data[:8+size+(size&1)]
+			data = data[len(chunk):]
+			if fourcc == b"VP8X":
+				chunk = chunk[:8] + bytes([chunk[8] & ~0x0C]) + chunk[9:]
+			if fourcc not in (b"EXIF", b"XMP "):
+				out += chunk
+		out[4:8] = struct.pack("<I", len(out) - 8)
+		return bytes(out)
+	return data
+
+def verify_image_variants(media, variants):
+	# the test images are larger than the largest variant
+	assert [max(v["width"], v["height"]) for v in variants] == [128, 512, 1024]
+	for variant in variants:
+		assert variant["contentType"] == "image/jpeg"
+		for url in [variant["url"], media(variant["id"])]:
+			response = requests.get(url)
+			assert response.status_code == 200
+			assert response.headers["Content-Type"] == "image/jpeg"
+
+def verify_blurhash(blurhash, x_components, y_components):
+	base83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+	assert all(c in base83 for c in blurhash)
+	size_flag = base83.index(blurhash[0])
+	assert (size_flag % 9 + 1, size_flag // 9 + 1) == (x_components, y_components)
+	assert len(blurhash) == 4 + 2 * x_components * y_components
+
 def verify_resource_deleted(url):
 	response = requests.get(url)
 	assert response.status_code == 404
+
+def build_mp4_box(box_type, payload):
+	return struct.pack(">I", len(payload) + 8) + box_type + payload
+
+def build_test_mp4(width, height, duration_ms):
+	"""Builds a minimal mp4 with a single empty video track."""
+	mvhd = struct.pack(">B3xIIII", 0, 0, 0, 1000, duration_ms) + bytes(80)
+	tkhd = (
+		struct.pack(">B3xIIIII", 0, 0, 0, 1, 0, duration_ms) + bytes(52) +
+		struct.pack(">II", width << 16, height << 16)
+	)
+	trak = build_mp4_box(b"trak", build_mp4_box(b"tkhd", tkhd))
+	return (
+		build_mp4_box(b"ftyp", b"isom\x00\x00\x02\x00isom") +
+		build_mp4_box(b"moov", build_mp4_box(b"mvhd", mvhd) + trak) +
+		build_mp4_box(b"mdat", bytes(1024))
+	)
+
+def build_test_wav(sample_rate, data_size):
+	"""Builds a mono 16-bit wav of a 480 Hz tone."""
+	period = struct.pack("<100h", *(
+		int(16384 * math.sin(2 * math.pi * i / 100)) for i in range(100)
+	))
+	data = (period * (data_size // len(period) + 1))[:data_size]
+	fmt = struct.pack("<HHIIHH", 1, 1, sample_rate, sample_rate * 2, 2, 16)
+	return (
+		b"RIFF" + struct.pack("<I", 36 + len(data)) + b"WAVE" +
+		b"fmt " + struct.pack("<I", len(fmt)) + fmt +
+		b"data" + struct.pack("<I", len(data)) + data
+	)
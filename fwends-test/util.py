@@ -1,5 +1,9 @@
 import time
+import hmac
+import hashlib
+import datetime
 import requests
+from urllib.parse import quote, urlsplit
 
 def wait_for_health_check(backend, timeout, delay):
 	start = time.time()
@@ -76,3 +80,31 @@ def get_replica_count(appsv1, namespace, app):
 def set_replica_count(appsv1, namespace, app, count):
 	body = {"spec": {"replicas": count}}
 	appsv1.patch_namespaced_deployment_scale(app, namespace, body)
+
+
+def presign_url(url, access_key, secret_key, region, expires=3600):
+	"""Presigns a GET of a url with aws signature version 4, as s3 does."""
+	now = datetime.datetime.now(datetime.timezone.utc)
+	date, timestamp = now.strftime("%Y%m%d"), now.strftime("%Y%m%dT%H%M%SZ")
+	scope = date + "/" + region + "/s3/aws4_request"
+	query = "&".join(
+		quote(name, safe="") + "=" + quote(value, safe="") for name, value in sorted({
+			"X-Amz-Algorithm": "AWS4-HMAC-SHA256",
+			"X-Amz-Credential": access_key + "/" + scope,
+			"X-Amz-Date": timestamp,
+			"X-Amz-Expires": str(expires),
+			"X-Amz-SignedHeaders": "host",
+		}.items())
+	)
+	parts = urlsplit(url)
+	canonical_request = "\n".join([
+		"GET", parts.path, query, "host:" + parts.netloc + "\n", "host", "UNSIGNED-PAYLOAD",
+	])
+	string_to_sign = "\n".join([
+		"AWS4-HMAC-SHA256", timestamp, scope, hashlib.sha256(canonical_request.encode()).hexdigest(),
+	])
+	key = ("AWS4" + secret_key).encode()
+	for value in [date, region, "s3", "aws4_request"]:
+		key = hmac.new(key, value.encode(), hashlib.sha256).digest()
+	signature = hmac.new(key, string_to_sign.encode(), hashlib.sha256).hexdigest()
+	return url + "?" + query + "&X-Amz-Signature=" + signature